@@ -0,0 +1,26 @@
+package extractor
+
+import "time"
+
+// Animation describes the playback of an animated image or an image sequence.
+type Animation struct {
+	// Number of frames.
+	Frames int
+
+	// Number of times the animation is played, 0 means infinitely.
+	LoopCount int
+
+	// Duration of a single playback, 0 if unknown.
+	Duration time.Duration
+}
+
+// Converts a duration expressed in timescale units per second to time.Duration.
+func timescaleDuration(units uint64, timescale uint32) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+
+	// Split into seconds and remainder to avoid overflowing on long durations
+	ts := uint64(timescale)
+	return time.Duration(units/ts)*time.Second + time.Duration(units%ts)*time.Second/time.Duration(ts)
+}
@@ -0,0 +1,171 @@
+package extractor
+
+import (
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+// Upper bound of the size of ICC profiles, real-world profiles are a few kilobytes,
+// up to a few hundred for profiles with large lookup tables.
+const maxICCSize = 4 << 20
+
+// Size of the header of ICC profiles, which is followed by the tag table.
+const iccHeaderSize = 128
+
+// Upper bound of the tags read from an ICC profile.
+const maxICCTags = 256
+
+// ColorProfile describes the color space of an image, from its embedded ICC profile
+// or from the color information signalled by the format.
+type ColorProfile struct {
+	// ICC profile embedded in the file, nil if there is none.
+	ICC []byte
+
+	// Description of the ICC profile (desc tag), e.g. "sRGB IEC61966-2.1" or "Display P3".
+	Description string
+
+	// Color space of the data of the ICC profile, e.g. "RGB", "GRAY" or "CMYK".
+	ColorSpace string
+
+	// Chromaticities of the primaries from the colorant tags of the ICC profile,
+	// which are adapted to its D50 connection space, or from PNG cHRM chunks. Nil if unknown.
+	Primaries *Primaries
+
+	// Coding-independent code points from PNG cICP chunks or HEIF nclx color information, nil if unknown.
+	CICP *CICP
+
+	// SRGB reports a PNG sRGB chunk, with the rendering intent the image should be displayed with.
+	SRGB            bool
+	RenderingIntent uint8
+
+	// Gamma from PNG gAMA chunks, e.g. 0.45455 for images encoded with a gamma of 2.2. 0 if unknown.
+	Gamma float64
+}
+
+// Chromaticity is a point of the CIE 1931 xy chromaticity diagram.
+type Chromaticity struct {
+	X float64
+	Y float64
+}
+
+// Primaries holds the chromaticities of the primaries and the white point of an RGB color space.
+type Primaries struct {
+	Red   Chromaticity
+	Green Chromaticity
+	Blue  Chromaticity
+	White Chromaticity
+}
+
+// CICP holds the code points of ITU-T H.273 describing a color space.
+type CICP struct {
+	ColorPrimaries          uint16
+	TransferCharacteristics uint16
+	MatrixCoefficients      uint16
+	FullRange               bool
+}
+
+// PrimariesName returns the common name of the color primaries, or an empty string for unknown code points.
+func (c CICP) PrimariesName() string {
+	switch c.ColorPrimaries {
+	case 1:
+		return "BT.709"
+	case 5, 6:
+		return "BT.601"
+	case 9:
+		return "BT.2020"
+	case 11:
+		return "DCI-P3"
+	case 12:
+		return "Display P3"
+	default:
+		return ""
+	}
+}
+
+// Creates a color profile from an ICC profile, reading its description, color space and primaries.
+// The header and tags are read on a best effort basis, the profile is kept even if they are malformed.
+func newICCColorProfile(icc []byte) *ColorProfile {
+	profile := &ColorProfile{ICC: icc}
+	if len(icc) < iccHeaderSize+4 || string(icc[36:40]) != "acsp" {
+		return profile
+	}
+	profile.ColorSpace = strings.TrimRight(string(icc[16:20]), " ")
+
+	// Tag table: count (4) followed by the signature, offset and size of each tag (4 each)
+	count := binary.BigEndian.Uint32(icc[iccHeaderSize:])
+	if count > maxICCTags || uint64(iccHeaderSize+4)+uint64(count)*12 > uint64(len(icc)) {
+		return profile
+	}
+
+	tags := make(map[string][]byte, count)
+	for i := uint32(0); i < count; i++ {
+		entry := icc[iccHeaderSize+4+i*12:]
+		offset, size := uint64(binary.BigEndian.Uint32(entry[4:8])), uint64(binary.BigEndian.Uint32(entry[8:12]))
+		if offset+size <= uint64(len(icc)) {
+			tags[string(entry[:4])] = icc[offset : offset+size]
+		}
+	}
+
+	profile.Description = iccText(tags["desc"])
+
+	red, hasRed := iccChromaticity(tags["rXYZ"])
+	green, hasGreen := iccChromaticity(tags["gXYZ"])
+	blue, hasBlue := iccChromaticity(tags["bXYZ"])
+	if hasRed && hasGreen && hasBlue {
+		white, _ := iccChromaticity(tags["wtpt"])
+		profile.Primaries = &Primaries{Red: red, Green: green, Blue: blue, White: white}
+	}
+	return profile
+}
+
+// Reads a textDescriptionType (ICC v2) or multiLocalizedUnicodeType (ICC v4) tag,
+// the latter in the language of its first record.
+func iccText(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+
+	switch string(tag[:4]) {
+	case "desc":
+		// ASCII count (4) including the terminating null, followed by the string
+		count := uint64(binary.BigEndian.Uint32(tag[8:12]))
+		if 12+count > uint64(len(tag)) {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+count]), "\x00")
+	case "mluc":
+		// Number of records (4) and record size (4), records hold a language and country code (2 each),
+		// the length and the offset from the start of the tag of a UTF-16BE string (4 each)
+		if len(tag) < 28 || binary.BigEndian.Uint32(tag[8:12]) == 0 {
+			return ""
+		}
+
+		length, offset := uint64(binary.BigEndian.Uint32(tag[20:24])), uint64(binary.BigEndian.Uint32(tag[24:28]))
+		if offset+length > uint64(len(tag)) {
+			return ""
+		}
+
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(tag[offset+uint64(i)*2:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	return ""
+}
+
+// Reads the chromaticity of an XYZType tag, whose values are s15Fixed16Number.
+func iccChromaticity(tag []byte) (Chromaticity, bool) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return Chromaticity{}, false
+	}
+
+	x := float64(int32(binary.BigEndian.Uint32(tag[8:12]))) / 65536
+	y := float64(int32(binary.BigEndian.Uint32(tag[12:16]))) / 65536
+	z := float64(int32(binary.BigEndian.Uint32(tag[16:20]))) / 65536
+	if sum := x + y + z; sum != 0 {
+		return Chromaticity{X: x / sum, Y: y / sum}, true
+	}
+	return Chromaticity{}, false
+}
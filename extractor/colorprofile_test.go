@@ -0,0 +1,130 @@
+package extractor_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/pillowskiy/imagesize/extractor"
+)
+
+// Builds an RGB ICC profile with the given description, as a textDescriptionType (ICC v2)
+// or a multiLocalizedUnicodeType (ICC v4) tag, and the colorants of sRGB adapted to D50.
+func iccProfile(descType, description string) []byte {
+	var desc []byte
+	if descType == "mluc" {
+		var text []byte
+		for _, unit := range utf16.Encode([]rune(description)) {
+			text = append(text, be16(unit)...)
+		}
+		desc = mergeBuffers([]byte("mluc"), be32(0), be32(1), be32(12), []byte("enUS"), be32(uint32(len(text))), be32(28), text)
+	} else {
+		desc = mergeBuffers([]byte("desc"), be32(0), be32(uint32(len(description)+1)), []byte(description), []byte{0x00})
+	}
+
+	xyz := func(x, y, z float64) []byte {
+		fixed := func(v float64) []byte { return be32(uint32(int32(math.Round(v * 65536)))) }
+		return mergeBuffers([]byte("XYZ "), be32(0), fixed(x), fixed(y), fixed(z))
+	}
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", desc},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+	}
+
+	table, data := be32(uint32(len(tags))), []byte(nil)
+	offset := 128 + 4 + 12*len(tags)
+	for _, tag := range tags {
+		table = mergeBuffers(table, []byte(tag.signature), be32(uint32(offset+len(data))), be32(uint32(len(tag.data))))
+		data = mergeBuffers(data, tag.data)
+	}
+
+	header := make([]byte, 128)
+	copy(header[0:], be32(uint32(128+len(table)+len(data))))
+	copy(header[12:], "mntrRGB XYZ ")
+	copy(header[36:], "acsp")
+	return mergeBuffers(header, table, data)
+}
+
+func TestColorProfile(t *testing.T) {
+	t.Parallel()
+	heif := extractor.HEIF{ReadColorProfile: true}
+
+	// Primary image (1) with an ICC profile and code points
+	file := func(properties ...[]byte) []byte {
+		associations := []byte{0x01}
+		for i := range properties {
+			associations = append(associations, byte(i+2))
+		}
+
+		return heifFile("heic",
+			isoBox("pitm", fullBox(0, 0), be16(1)),
+			isoBox("iinf", fullBox(0, 0), be16(1), heifItemEntry(1, "hvc1")),
+			isoBox("iprp",
+				isoBox("ipco", mergeBuffers(heifIspe(16, 8), mergeBuffers(properties...))),
+				isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, associations...)),
+			),
+		)
+	}
+
+	nclx := isoBox("colr", []byte("nclx"), be16(12), be16(13), be16(1), []byte{0x80})
+
+	for _, descType := range []string{"desc", "mluc"} {
+		t.Run(descType, func(t *testing.T) {
+			icc := iccProfile(descType, "Display P3")
+			info, err := heif.ExtractInfo(bytes.NewReader(file(isoBox("colr", []byte("prof"), icc), nclx)))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			profile := info.ColorProfile
+			if profile == nil {
+				t.Fatal("expected color profile, got nil")
+			}
+
+			if !bytes.Equal(profile.ICC, icc) || profile.Description != "Display P3" || profile.ColorSpace != "RGB" {
+				t.Errorf("expected RGB profile \"Display P3\" of %d bytes, got %q %q of %d bytes",
+					len(icc), profile.ColorSpace, profile.Description, len(profile.ICC))
+			}
+
+			if primaries := profile.Primaries; primaries == nil ||
+				math.Abs(primaries.Red.X-0.6485) > 1e-3 || math.Abs(primaries.Red.Y-0.3309) > 1e-3 ||
+				math.Abs(primaries.White.X-0.3457) > 1e-3 || math.Abs(primaries.White.Y-0.3585) > 1e-3 {
+				t.Errorf("expected sRGB primaries adapted to D50, got %+v", primaries)
+			}
+
+			expected := extractor.CICP{ColorPrimaries: 12, TransferCharacteristics: 13, MatrixCoefficients: 1, FullRange: true}
+			if profile.CICP == nil || *profile.CICP != expected {
+				t.Errorf("expected code points %+v, got %+v", expected, profile.CICP)
+			}
+
+			if name := profile.CICP.PrimariesName(); name != "Display P3" {
+				t.Errorf("expected Display P3 primaries, got %q", name)
+			}
+		})
+	}
+
+	t.Run("NotRequested", func(t *testing.T) {
+		info, err := extractor.HEIF{}.ExtractInfo(bytes.NewReader(file(nclx)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.ColorProfile != nil {
+			t.Errorf("expected no color profile unless requested, got %+v", info.ColorProfile)
+		}
+	})
+
+	t.Run("TruncatedColourInformation", func(t *testing.T) {
+		if _, err := heif.ExtractInfo(bytes.NewReader(file(isoBox("colr", []byte("nclx"), be16(1))))); err == nil {
+			t.Error("expected error due to truncated nclx, got nil")
+		}
+	})
+}
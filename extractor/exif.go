@@ -0,0 +1,493 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var exifHeader = []byte("Exif\x00\x00")
+
+// Upper bound of EXIF blocks read from chunks and items, EXIF blocks rarely exceed 64 KiB.
+const maxEXIFSize = 1 << 20
+
+// Orientation is the EXIF orientation (tag 0x0112) of an image,
+// telling how the stored pixels have to be transformed for display.
+type Orientation uint8
+
+const (
+	// OrientationUnknown means that the image carries no orientation.
+	OrientationUnknown Orientation = iota
+
+	// OrientationNormal needs no transformation.
+	OrientationNormal
+
+	// OrientationMirrorHorizontal is mirrored left to right.
+	OrientationMirrorHorizontal
+
+	// OrientationRotate180 is rotated by 180 degrees.
+	OrientationRotate180
+
+	// OrientationMirrorVertical is mirrored top to bottom.
+	OrientationMirrorVertical
+
+	// OrientationTranspose is mirrored left to right and rotated 270 degrees clockwise.
+	OrientationTranspose
+
+	// OrientationRotate90 needs a 90 degrees clockwise rotation.
+	OrientationRotate90
+
+	// OrientationTransverse is mirrored left to right and rotated 90 degrees clockwise.
+	OrientationTransverse
+
+	// OrientationRotate270 needs a 270 degrees clockwise rotation.
+	OrientationRotate270
+)
+
+// SwapsDimensions reports whether displaying the image swaps its width and height.
+func (o Orientation) SwapsDimensions() bool {
+	return o >= OrientationTranspose && o <= OrientationRotate270
+}
+
+// Apply returns the display size of an image of the given stored size.
+func (o Orientation) Apply(width, height int) (int, int) {
+	if o.SwapsDimensions() {
+		return height, width
+	}
+	return width, height
+}
+
+// OrientedSize is embedded in the details of the formats that can carry an EXIF orientation.
+type OrientedSize struct {
+	// Orientation from the EXIF data of the image.
+	Orientation Orientation
+
+	// Size of the image once displayed.
+	DisplayWidth  int
+	DisplayHeight int
+}
+
+// Oriented returns the orientation and display size, regardless of the details embedding them.
+func (s OrientedSize) Oriented() OrientedSize {
+	return s
+}
+
+// Opens TIFF data of EXIF blocks, with or without the "Exif\0\0" prefix of JPEG APP1 segments
+// that some writers keep in other formats too. Returns nil for malformed data,
+// which is ignored as it does not affect the image itself.
+func openEXIF(buf []byte) *tiffData {
+	data, err := newEXIFData(buf)
+	if err != nil {
+		if data, err = newTIFFData(buf); err != nil {
+			return nil
+		}
+	}
+	return data
+}
+
+// Reads the orientation from EXIF data, if any, and computes the display size of an image of the given size.
+func orientedSize(exif *tiffData, width, height int) OrientedSize {
+	size := OrientedSize{DisplayWidth: width, DisplayHeight: height}
+	if exif == nil {
+		return size
+	}
+
+	if orientation, err := exif.orientation(); err == nil {
+		size.Orientation = orientation
+		size.DisplayWidth, size.DisplayHeight = orientation.Apply(width, height)
+	}
+	return size
+}
+
+// Reads the resolution from EXIF data, if any. The physical size is computed by resolveResolution.
+func exifResolution(exif *tiffData) Resolution {
+	if exif == nil {
+		return Resolution{}
+	}
+
+	x, y, unit, err := exif.resolution()
+	if err != nil {
+		return Resolution{}
+	}
+	return newResolution(ResolutionEXIF, x, y, unit)
+}
+
+// TIFF tags read from EXIF data.
+const (
+	tiffTagOrientation    = 0x0112
+	tiffTagXResolution    = 0x011A
+	tiffTagYResolution    = 0x011B
+	tiffTagResolutionUnit = 0x0128
+
+	// XMP packet, as bytes
+	tiffTagXMP = 0x02BC
+
+	// Offset and length of the JPEG thumbnail in IFD1
+	tiffTagJPEGInterchangeFormat       = 0x0201
+	tiffTagJPEGInterchangeFormatLength = 0x0202
+)
+
+// Values of the ResolutionUnit tag.
+const (
+	tiffResolutionNone       = 1
+	tiffResolutionInch       = 2
+	tiffResolutionCentimeter = 3
+)
+
+// TIFF field types.
+const (
+	tiffTypeByte      = 1
+	tiffTypeASCII     = 2
+	tiffTypeShort     = 3
+	tiffTypeLong      = 4
+	tiffTypeRational  = 5
+	tiffTypeUndefined = 7
+	tiffTypeSLong     = 9
+	tiffTypeSRational = 10
+	tiffTypeIFD       = 13
+)
+
+var tiffTypeSizes = map[uint16]uint32{
+	tiffTypeByte:      1,
+	tiffTypeASCII:     1,
+	tiffTypeShort:     2,
+	tiffTypeLong:      4,
+	tiffTypeRational:  8,
+	tiffTypeUndefined: 1,
+	tiffTypeSLong:     4,
+	tiffTypeSRational: 8,
+	tiffTypeIFD:       4,
+}
+
+// Upper bound of entries read from a single IFD, real-world IFDs have a few dozen.
+const maxTIFFEntries = 512
+
+// Upper bound of entries read from all the IFDs of TIFF data, which bounds the work done
+// on data whose IFDs point to each other.
+const maxTIFFVisitedEntries = 1024
+
+var errInvalidTIFF = errors.New("invalid TIFF header")
+
+// tiffData reads Image File Directories (IFD) from in-memory TIFF data, such as EXIF blocks.
+// See https://www.media.mit.edu/pia/Research/deepview/exif.html
+type tiffData struct {
+	buf   []byte
+	order binary.ByteOrder
+
+	// Entries of IFD0 and offset of IFD1, read once by ifd0.
+	ifd0Entries []tiffEntry
+	ifd0Err     error
+	ifd0Read    bool
+	ifd1Offset  uint32
+
+	// Entries read so far, see maxTIFFVisitedEntries.
+	visited uint32
+}
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+
+	// Raw bytes of the value, either inline or resolved from the value offset.
+	value []byte
+}
+
+// Creates a reader for TIFF data starting with the "II*\0" or "MM\0*" byte order mark.
+func newTIFFData(buf []byte) (*tiffData, error) {
+	if len(buf) < 8 {
+		return nil, errInvalidTIFF
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(buf, []byte("II*\x00")):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(buf, []byte("MM\x00*")):
+		order = binary.BigEndian
+	default:
+		return nil, errInvalidTIFF
+	}
+
+	return &tiffData{buf: buf, order: order}, nil
+}
+
+// Creates a reader for the TIFF data of an EXIF block prefixed with "Exif\0\0",
+// as stored in JPEG APP1 segments.
+func newEXIFData(buf []byte) (*tiffData, error) {
+	if !bytes.HasPrefix(buf, exifHeader) {
+		return nil, errors.New("missing EXIF header")
+	}
+	return newTIFFData(buf[len(exifHeader):])
+}
+
+// Returns the size of the TIFF data (or EXIF block) needed to read the entries of IFD0 and the values
+// of the given tags, from its first bytes. The size grows as more bytes are provided, it is final
+// once buf is at least that large.
+func tiffIFD0Size(buf []byte, tags ...uint16) (uint64, error) {
+	if bytes.HasPrefix(buf, exifHeader) {
+		size, err := tiffIFD0Size(buf[len(exifHeader):], tags...)
+		return uint64(len(exifHeader)) + size, err
+	}
+	if len(buf) < 8 {
+		return 8, nil
+	}
+
+	t, err := newTIFFData(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	offset := uint64(t.firstIFD())
+	if offset+2 > uint64(len(buf)) {
+		return offset + 2, nil
+	}
+
+	count := uint64(t.order.Uint16(buf[offset:]))
+	if count > maxTIFFEntries {
+		return 0, errors.New("too many IFD entries")
+	}
+
+	size := offset + 2 + count*12
+	if size > uint64(len(buf)) {
+		return size, nil
+	}
+
+	for i := uint64(0); i < count; i++ {
+		raw := buf[offset+2+i*12:]
+		typeSize, ok := tiffTypeSizes[t.order.Uint16(raw[2:4])]
+		if !ok || !containsTIFFTag(tags, t.order.Uint16(raw[0:2])) {
+			continue
+		}
+
+		// Values of up to 4 bytes are inline
+		valueSize := uint64(typeSize) * uint64(t.order.Uint32(raw[4:8]))
+		if end := uint64(t.order.Uint32(raw[8:12])) + valueSize; valueSize > 4 && end > size {
+			size = end
+		}
+	}
+	return size, nil
+}
+
+func containsTIFFTag(tags []uint16, tag uint16) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the offset of the first IFD (IFD0).
+func (t *tiffData) firstIFD() uint32 {
+	return t.order.Uint32(t.buf[4:8])
+}
+
+// Reads the entries of the IFD at the given offset along with the offset of the next IFD.
+func (t *tiffData) readIFD(offset uint32) (entries []tiffEntry, next uint32, err error) {
+	if uint64(offset)+2 > uint64(len(t.buf)) {
+		err = errors.New("IFD offset out of bounds")
+		return
+	}
+
+	count := uint32(t.order.Uint16(t.buf[offset:]))
+	if count > maxTIFFEntries || t.visited+count > maxTIFFVisitedEntries {
+		err = errors.New("too many IFD entries")
+		return
+	}
+	t.visited += count
+
+	start := offset + 2
+	if uint64(start)+uint64(count)*12 > uint64(len(t.buf)) {
+		err = errors.New("IFD is truncated")
+		return
+	}
+
+	entries = make([]tiffEntry, 0, count)
+	for i := uint32(0); i < count; i++ {
+		raw := t.buf[start+i*12 : start+i*12+12]
+
+		entry := tiffEntry{
+			tag:   t.order.Uint16(raw[0:2]),
+			typ:   t.order.Uint16(raw[2:4]),
+			count: t.order.Uint32(raw[4:8]),
+		}
+
+		// Skip entries of unknown types, their size cannot be determined
+		typeSize, ok := tiffTypeSizes[entry.typ]
+		if !ok {
+			continue
+		}
+
+		size := uint64(typeSize) * uint64(entry.count)
+		if size <= 4 {
+			entry.value = raw[8 : 8+size]
+		} else {
+			valueOffset := uint64(t.order.Uint32(raw[8:12]))
+			if valueOffset+size > uint64(len(t.buf)) {
+				continue
+			}
+			entry.value = t.buf[valueOffset : valueOffset+size]
+		}
+
+		entries = append(entries, entry)
+	}
+
+	// The next IFD offset is optional for the last IFD
+	if end := uint64(start) + uint64(count)*12; end+4 <= uint64(len(t.buf)) {
+		next = t.order.Uint32(t.buf[end:])
+	}
+
+	return entries, next, nil
+}
+
+// Returns the first value of an integer entry.
+func (t *tiffData) uintValue(entry tiffEntry) (uint32, bool) {
+	if entry.count == 0 {
+		return 0, false
+	}
+
+	switch entry.typ {
+	case tiffTypeByte, tiffTypeUndefined:
+		return uint32(entry.value[0]), true
+	case tiffTypeShort:
+		return uint32(t.order.Uint16(entry.value)), true
+	case tiffTypeLong, tiffTypeSLong, tiffTypeIFD:
+		return t.order.Uint32(entry.value), true
+	}
+	return 0, false
+}
+
+// Returns the first value of a rational entry.
+func (t *tiffData) rationalValue(entry tiffEntry) (float64, bool) {
+	return t.rationalAt(entry, 0)
+}
+
+// Returns the value at the given index of a rational entry, failing for a zero denominator.
+func (t *tiffData) rationalAt(entry tiffEntry, index uint32) (float64, bool) {
+	if index >= entry.count || (entry.typ != tiffTypeRational && entry.typ != tiffTypeSRational) {
+		return 0, false
+	}
+
+	value := entry.value[8*index:]
+	numerator, denominator := t.order.Uint32(value[0:4]), t.order.Uint32(value[4:8])
+	if denominator == 0 {
+		return 0, false
+	}
+
+	if entry.typ == tiffTypeSRational {
+		return float64(int32(numerator)) / float64(int32(denominator)), true
+	}
+	return float64(numerator) / float64(denominator), true
+}
+
+// Reads the entries of IFD0, which describe the main image.
+func (t *tiffData) ifd0() ([]tiffEntry, error) {
+	if !t.ifd0Read {
+		t.ifd0Entries, t.ifd1Offset, t.ifd0Err = t.readIFD(t.firstIFD())
+		t.ifd0Read = true
+	}
+	return t.ifd0Entries, t.ifd0Err
+}
+
+// Reads the XMP packet of IFD0, nil if there is none.
+func (t *tiffData) xmp() []byte {
+	entries, err := t.ifd0()
+	if err != nil {
+		return nil
+	}
+
+	entry, ok := findTIFFEntry(entries, tiffTagXMP)
+	if !ok || (entry.typ != tiffTypeByte && entry.typ != tiffTypeUndefined) || len(entry.value) > maxXMPSize {
+		return nil
+	}
+	return entry.value
+}
+
+// Reads the location of the JPEG thumbnail described by IFD1, relative to the start of the TIFF data.
+func (t *tiffData) thumbnail() (offset, length uint32, ok bool) {
+	if _, err := t.ifd0(); err != nil || t.ifd1Offset == 0 {
+		return 0, 0, false
+	}
+
+	entries, _, err := t.readIFD(t.ifd1Offset)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	offsetEntry, hasOffset := findTIFFEntry(entries, tiffTagJPEGInterchangeFormat)
+	lengthEntry, hasLength := findTIFFEntry(entries, tiffTagJPEGInterchangeFormatLength)
+	if !hasOffset || !hasLength {
+		return 0, 0, false
+	}
+
+	offset, hasOffset = t.uintValue(offsetEntry)
+	length, hasLength = t.uintValue(lengthEntry)
+	if !hasOffset || !hasLength || length == 0 || uint64(offset)+uint64(length) > uint64(len(t.buf)) {
+		return 0, 0, false
+	}
+	return offset, length, true
+}
+
+// Looks up an entry by tag.
+func findTIFFEntry(entries []tiffEntry, tag uint16) (tiffEntry, bool) {
+	for _, entry := range entries {
+		if entry.tag == tag {
+			return entry, true
+		}
+	}
+	return tiffEntry{}, false
+}
+
+// Reads the orientation tag of IFD0, OrientationUnknown if there is none or it is out of range.
+func (t *tiffData) orientation() (Orientation, error) {
+	entries, err := t.ifd0()
+	if err != nil {
+		return OrientationUnknown, err
+	}
+
+	entry, ok := findTIFFEntry(entries, tiffTagOrientation)
+	if !ok {
+		return OrientationUnknown, nil
+	}
+
+	value, ok := t.uintValue(entry)
+	if !ok || value < uint32(OrientationNormal) || value > uint32(OrientationRotate270) {
+		return OrientationUnknown, nil
+	}
+	return Orientation(value), nil
+}
+
+// Reads the resolution tags of IFD0, the unit defaulting to inches as per the TIFF specification.
+func (t *tiffData) resolution() (x, y float64, unit densityUnit, err error) {
+	entries, err := t.ifd0()
+	if err != nil {
+		return
+	}
+
+	xEntry, hasX := findTIFFEntry(entries, tiffTagXResolution)
+	yEntry, hasY := findTIFFEntry(entries, tiffTagYResolution)
+	if !hasX || !hasY {
+		err = errors.New("missing resolution tags")
+		return
+	}
+
+	var xOK, yOK bool
+	x, xOK = t.rationalValue(xEntry)
+	y, yOK = t.rationalValue(yEntry)
+	if !xOK || !yOK {
+		err = errors.New("invalid resolution tags")
+		return
+	}
+
+	unit = densityPerInch
+	if entry, ok := findTIFFEntry(entries, tiffTagResolutionUnit); ok {
+		switch value, _ := t.uintValue(entry); value {
+		case tiffResolutionNone:
+			unit = densityAspectOnly
+		case tiffResolutionCentimeter:
+			unit = densityPerCentimeter
+		}
+	}
+	return
+}
@@ -0,0 +1,238 @@
+package extractor
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tags of IFD0 pointing to the Exif and GPS IFDs, and tags read from IFD0 and the Exif IFD.
+// The MakerNote tag (0x927C) of the Exif IFD is never followed: its layout is vendor specific
+// and its offsets are often relative to the maker note itself rather than to the TIFF data.
+const (
+	tiffTagMake               = 0x010F
+	tiffTagModel              = 0x0110
+	tiffTagExifIFD            = 0x8769
+	tiffTagGPSIFD             = 0x8825
+	exifTagExposureTime       = 0x829A
+	exifTagFNumber            = 0x829D
+	exifTagISOSpeed           = 0x8827
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagOffsetTime         = 0x9010
+	exifTagOffsetTimeOriginal = 0x9011
+	exifTagExposureBias       = 0x9204
+	exifTagFocalLength        = 0x920A
+	exifTagSubSecTimeOriginal = 0x9291
+	exifTagFocalLength35mm    = 0xA405
+	exifTagLensMake           = 0xA433
+	exifTagLensModel          = 0xA434
+)
+
+// Tags of the GPS IFD.
+const (
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+	gpsTagAltitudeRef  = 0x0005
+	gpsTagAltitude     = 0x0006
+)
+
+// EXIF holds common fields of the EXIF data of an image, decoded into Go types.
+// Fields are left to their zero value when their tag is missing or malformed.
+type EXIF struct {
+	// Camera and lens, as written by the manufacturer.
+	Make      string
+	Model     string
+	LensMake  string
+	LensModel string
+
+	// DateTimeOriginal is when the picture was taken, in the time zone of the OffsetTimeOriginal
+	// (or OffsetTime) tag. Cameras without these tags write local times, which are then returned
+	// in UTC with HasTimeOffset false. Zero if unknown.
+	DateTimeOriginal time.Time
+	HasTimeOffset    bool
+
+	// Exposure time in seconds, f-number and ISO speed.
+	ExposureTime float64
+	FNumber      float64
+	ISO          int
+
+	// Exposure bias in EV.
+	ExposureBias float64
+
+	// Focal length in millimeters, and its 35mm film equivalent.
+	FocalLength     float64
+	FocalLength35mm int
+
+	// Position of the GPS IFD, nil if the image has none.
+	GPS *GPSPosition
+}
+
+// GPSPosition is a position read from the GPS IFD of EXIF data.
+type GPSPosition struct {
+	// Latitude and longitude in decimal degrees, negative south of the equator and west of the prime meridian.
+	Latitude  float64
+	Longitude float64
+
+	// Altitude in meters, negative below sea level, if HasAltitude.
+	Altitude    float64
+	HasAltitude bool
+}
+
+// Decodes the fields of IFD0, the Exif IFD and the GPS IFD. Returns nil if IFD0 cannot be read,
+// sub-IFDs that cannot be read are ignored.
+func newEXIF(t *tiffData) *EXIF {
+	ifd0, err := t.ifd0()
+	if err != nil {
+		return nil
+	}
+
+	exif := &EXIF{
+		Make:  t.stringValue(ifd0, tiffTagMake),
+		Model: t.stringValue(ifd0, tiffTagModel),
+	}
+
+	if entries, ok := t.subIFD(ifd0, tiffTagExifIFD); ok {
+		exif.LensMake = t.stringValue(entries, exifTagLensMake)
+		exif.LensModel = t.stringValue(entries, exifTagLensModel)
+		exif.DateTimeOriginal, exif.HasTimeOffset = t.dateTimeOriginal(entries)
+
+		exif.ExposureTime = t.rationalTag(entries, exifTagExposureTime)
+		exif.FNumber = t.rationalTag(entries, exifTagFNumber)
+		exif.ExposureBias = t.rationalTag(entries, exifTagExposureBias)
+		exif.FocalLength = t.rationalTag(entries, exifTagFocalLength)
+		exif.ISO = int(t.uintTag(entries, exifTagISOSpeed))
+		exif.FocalLength35mm = int(t.uintTag(entries, exifTagFocalLength35mm))
+	}
+
+	if entries, ok := t.subIFD(ifd0, tiffTagGPSIFD); ok {
+		exif.GPS = t.gpsPosition(entries)
+	}
+	return exif
+}
+
+// Reads the IFD the given pointer tag points to.
+func (t *tiffData) subIFD(entries []tiffEntry, tag uint16) ([]tiffEntry, bool) {
+	entry, ok := findTIFFEntry(entries, tag)
+	if !ok {
+		return nil, false
+	}
+
+	offset, ok := t.uintValue(entry)
+	if !ok || offset == 0 {
+		return nil, false
+	}
+
+	subEntries, _, err := t.readIFD(offset)
+	return subEntries, err == nil
+}
+
+// Reads an ASCII entry up to its first null, without padding spaces.
+func (t *tiffData) stringValue(entries []tiffEntry, tag uint16) string {
+	entry, ok := findTIFFEntry(entries, tag)
+	if !ok || entry.typ != tiffTypeASCII {
+		return ""
+	}
+
+	value := entry.value
+	if end := bytes.IndexByte(value, 0); end >= 0 {
+		value = value[:end]
+	}
+	return strings.TrimSpace(string(value))
+}
+
+// Reads the first value of a rational entry, 0 if it is missing or malformed.
+func (t *tiffData) rationalTag(entries []tiffEntry, tag uint16) float64 {
+	entry, ok := findTIFFEntry(entries, tag)
+	if !ok {
+		return 0
+	}
+
+	value, _ := t.rationalValue(entry)
+	return value
+}
+
+// Reads the first value of an integer entry, 0 if it is missing or malformed.
+func (t *tiffData) uintTag(entries []tiffEntry, tag uint16) uint32 {
+	entry, ok := findTIFFEntry(entries, tag)
+	if !ok {
+		return 0
+	}
+
+	value, _ := t.uintValue(entry)
+	return value
+}
+
+// Reads the DateTimeOriginal tag ("2006:01:02 15:04:05") along with its fraction of a second
+// and its offset from UTC ("+01:00").
+func (t *tiffData) dateTimeOriginal(entries []tiffEntry) (time.Time, bool) {
+	location, hasOffset := time.UTC, false
+	offset := t.stringValue(entries, exifTagOffsetTimeOriginal)
+	if offset == "" {
+		offset = t.stringValue(entries, exifTagOffsetTime)
+	}
+	if zone, err := time.Parse("-07:00", offset); err == nil {
+		_, seconds := zone.Zone()
+		location, hasOffset = time.FixedZone(offset, seconds), true
+	}
+
+	taken, err := time.ParseInLocation("2006:01:02 15:04:05", t.stringValue(entries, exifTagDateTimeOriginal), location)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// Digits of the fraction of a second, "05" meaning 50 milliseconds
+	if subSec := t.stringValue(entries, exifTagSubSecTimeOriginal); subSec != "" && len(subSec) <= 9 {
+		if fraction, err := strconv.ParseUint(subSec, 10, 32); err == nil {
+			for i := len(subSec); i < 9; i++ {
+				fraction *= 10
+			}
+			taken = taken.Add(time.Duration(fraction))
+		}
+	}
+	return taken, hasOffset
+}
+
+// Reads the position of the GPS IFD, nil without a valid latitude and longitude.
+// Coordinates are stored as degrees, minutes and seconds (3 rationals) with an "N" or "S"
+// (respectively "E" or "W") reference, the altitude as a rational with a reference of 1 below sea level.
+func (t *tiffData) gpsPosition(entries []tiffEntry) *GPSPosition {
+	latitude, hasLatitude := t.gpsCoordinate(entries, gpsTagLatitude, gpsTagLatitudeRef, "S")
+	longitude, hasLongitude := t.gpsCoordinate(entries, gpsTagLongitude, gpsTagLongitudeRef, "W")
+	if !hasLatitude || !hasLongitude || latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return nil
+	}
+
+	position := &GPSPosition{Latitude: latitude, Longitude: longitude}
+	if entry, ok := findTIFFEntry(entries, gpsTagAltitude); ok {
+		position.Altitude, position.HasAltitude = t.rationalValue(entry)
+		if t.uintTag(entries, gpsTagAltitudeRef) == 1 {
+			position.Altitude = -position.Altitude
+		}
+	}
+	return position
+}
+
+func (t *tiffData) gpsCoordinate(entries []tiffEntry, tag, refTag uint16, negativeRef string) (float64, bool) {
+	entry, ok := findTIFFEntry(entries, tag)
+	if !ok {
+		return 0, false
+	}
+
+	// Minutes and seconds are often written as 0/0 when the degrees hold a fraction
+	coordinate := 0.0
+	for i, unit := range []float64{1, 60, 3600} {
+		value, ok := t.rationalAt(entry, uint32(i))
+		if !ok && i == 0 {
+			return 0, false
+		}
+		coordinate += value / unit
+	}
+
+	if t.stringValue(entries, refTag) == negativeRef {
+		coordinate = -coordinate
+	}
+	return coordinate, true
+}
@@ -0,0 +1,318 @@
+package extractor_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/pillowskiy/imagesize/extractor"
+)
+
+type tiffTestEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func tiffShort(order binary.ByteOrder, tag uint16, value uint16) tiffTestEntry {
+	buf := make([]byte, 2)
+	order.PutUint16(buf, value)
+	return tiffTestEntry{tag: tag, typ: 3, count: 1, value: buf}
+}
+
+func tiffRational(order binary.ByteOrder, tag uint16, numerator, denominator uint32) tiffTestEntry {
+	buf := make([]byte, 8)
+	order.PutUint32(buf, numerator)
+	order.PutUint32(buf[4:], denominator)
+	return tiffTestEntry{tag: tag, typ: 5, count: 1, value: buf}
+}
+
+// Builds TIFF data with a chain of IFDs, values larger than 4 bytes are stored after the IFDs.
+func tiffBlock(order binary.ByteOrder, ifds ...[]tiffTestEntry) []byte {
+	header := []byte("II*\x00")
+	if order == binary.BigEndian {
+		header = []byte("MM\x00*")
+	}
+
+	ifdsSize := 0
+	for _, ifd := range ifds {
+		ifdsSize += 2 + 12*len(ifd) + 4
+	}
+
+	buf := make([]byte, 8, 8+ifdsSize)
+	copy(buf, header)
+	order.PutUint32(buf[4:], 8)
+
+	var data []byte
+	dataOffset := 8 + ifdsSize
+	for i, ifd := range ifds {
+		buf = append(buf, 0, 0)
+		order.PutUint16(buf[len(buf)-2:], uint16(len(ifd)))
+
+		for _, entry := range ifd {
+			raw := make([]byte, 12)
+			order.PutUint16(raw[0:], entry.tag)
+			order.PutUint16(raw[2:], entry.typ)
+			order.PutUint32(raw[4:], entry.count)
+			if len(entry.value) <= 4 {
+				copy(raw[8:], entry.value)
+			} else {
+				order.PutUint32(raw[8:], uint32(dataOffset+len(data)))
+				data = append(data, entry.value...)
+			}
+			buf = append(buf, raw...)
+		}
+
+		next := make([]byte, 4)
+		if i < len(ifds)-1 {
+			order.PutUint32(next, uint32(len(buf)+4))
+		}
+		buf = append(buf, next...)
+	}
+
+	return append(buf, data...)
+}
+
+// Builds an EXIF block as stored in JPEG APP1 segments.
+func exifBlock(order binary.ByteOrder, ifds ...[]tiffTestEntry) []byte {
+	return mergeBuffers([]byte("Exif\x00\x00"), tiffBlock(order, ifds...))
+}
+
+func TestOrientation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		orientation   extractor.Orientation
+		width, height int
+	}{
+		{extractor.OrientationUnknown, 1, 2},
+		{extractor.OrientationNormal, 1, 2},
+		{extractor.OrientationMirrorHorizontal, 1, 2},
+		{extractor.OrientationRotate180, 1, 2},
+		{extractor.OrientationMirrorVertical, 1, 2},
+		{extractor.OrientationTranspose, 2, 1},
+		{extractor.OrientationRotate90, 2, 1},
+		{extractor.OrientationTransverse, 2, 1},
+		{extractor.OrientationRotate270, 2, 1},
+	}
+
+	for _, tt := range tests {
+		width, height := tt.orientation.Apply(1, 2)
+		if width != tt.width || height != tt.height {
+			t.Errorf("orientation %d: expected %dx%d, got %dx%d", tt.orientation, tt.width, tt.height, width, height)
+		}
+	}
+}
+
+func tiffASCII(tag uint16, value string) tiffTestEntry {
+	return tiffTestEntry{tag: tag, typ: 2, count: uint32(len(value) + 1), value: append([]byte(value), 0x00)}
+}
+
+func tiffLong(order binary.ByteOrder, tag uint16, value uint32) tiffTestEntry {
+	buf := make([]byte, 4)
+	order.PutUint32(buf, value)
+	return tiffTestEntry{tag: tag, typ: 4, count: 1, value: buf}
+}
+
+// Builds a rational entry from numerator and denominator pairs.
+func tiffRationals(order binary.ByteOrder, tag uint16, typ uint16, values ...uint32) tiffTestEntry {
+	buf := make([]byte, 4*len(values))
+	for i, value := range values {
+		order.PutUint32(buf[4*i:], value)
+	}
+	return tiffTestEntry{tag: tag, typ: typ, count: uint32(len(values) / 2), value: buf}
+}
+
+// Size of an IFD built by tiffBlock.
+func tiffIFDSize(ifd []tiffTestEntry) uint32 {
+	return uint32(2 + 12*len(ifd) + 4)
+}
+
+func TestEXIF(t *testing.T) {
+	t.Parallel()
+	jpeg := extractor.JPEG{ReadEXIF: true}
+
+	sof := []byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00}
+	jpegFile := func(exif []byte) []byte {
+		return mergeBuffers([]byte{0xFF, 0xD8, 0xFF, 0xE1}, be16(uint16(2+len(exif))), exif, sof)
+	}
+
+	// IFD0 pointing to the Exif and GPS IFDs, which tiffBlock places right after it
+	exifFile := func(order binary.ByteOrder, ifd0, exifIFD, gpsIFD []tiffTestEntry) []byte {
+		ifd0 = append(ifd0, tiffLong(order, 0x8769, 0), tiffLong(order, 0x8825, 0))
+		exifOffset := 8 + tiffIFDSize(ifd0)
+		ifd0[len(ifd0)-2] = tiffLong(order, 0x8769, exifOffset)
+		ifd0[len(ifd0)-1] = tiffLong(order, 0x8825, exifOffset+tiffIFDSize(exifIFD))
+		return jpegFile(exifBlock(order, ifd0, exifIFD, gpsIFD))
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			ifd0 := []tiffTestEntry{tiffASCII(0x010F, "Canon"), tiffASCII(0x0110, "Canon EOS R5  ")}
+			exifIFD := []tiffTestEntry{
+				tiffRationals(order, 0x829A, 5, 1, 250),
+				tiffRationals(order, 0x829D, 5, 28, 10),
+				tiffShort(order, 0x8827, 400),
+				tiffASCII(0x9003, "2023:07:14 18:30:05"),
+				tiffASCII(0x9011, "+02:00"),
+				tiffRationals(order, 0x9204, 10, uint32(0xFFFFFFFD), 3), // -3/3 EV
+				tiffRationals(order, 0x920A, 5, 50, 1),
+				tiffASCII(0x9291, "25"),
+				tiffShort(order, 0xA405, 50),
+				tiffASCII(0xA434, "RF24-105mm F4 L IS USM"),
+				// Maker note whose offset points past the end of the data
+				{tag: 0x927C, typ: 7, count: 1 << 20, value: []byte{0xFF, 0xFF, 0xFF, 0x00}},
+			}
+			gpsIFD := []tiffTestEntry{
+				tiffASCII(0x0001, "S"),
+				tiffRationals(order, 0x0002, 5, 33, 1, 51, 1, 3564, 100),
+				tiffASCII(0x0003, "E"),
+				tiffRationals(order, 0x0004, 5, 151, 1, 12, 1, 3000, 100),
+				{tag: 0x0005, typ: 1, count: 1, value: []byte{0x01}},
+				tiffRationals(order, 0x0006, 5, 12, 1),
+			}
+
+			info, err := jpeg.ExtractInfo(bytes.NewReader(exifFile(order, ifd0, exifIFD, gpsIFD)))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			exif := info.EXIF
+			if exif == nil {
+				t.Fatal("expected EXIF fields, got nil")
+			}
+
+			if exif.Make != "Canon" || exif.Model != "Canon EOS R5" || exif.LensModel != "RF24-105mm F4 L IS USM" {
+				t.Errorf("expected a Canon EOS R5 with an RF24-105mm lens, got %q %q %q", exif.Make, exif.Model, exif.LensModel)
+			}
+
+			expectedTime := time.Date(2023, 7, 14, 16, 30, 5, 250*int(time.Millisecond), time.UTC)
+			if !exif.DateTimeOriginal.Equal(expectedTime) || !exif.HasTimeOffset {
+				t.Errorf("expected %v with an offset, got %v (offset %t)", expectedTime, exif.DateTimeOriginal, exif.HasTimeOffset)
+			}
+			if _, offset := exif.DateTimeOriginal.Zone(); offset != 2*3600 {
+				t.Errorf("expected a UTC+2 time zone, got an offset of %ds", offset)
+			}
+
+			if exif.ExposureTime != 1.0/250 || exif.FNumber != 2.8 || exif.ISO != 400 || exif.ExposureBias != -1 {
+				t.Errorf("expected 1/250s at f/2.8, ISO 400 and -1 EV, got %vs at f/%v, ISO %d and %v EV",
+					exif.ExposureTime, exif.FNumber, exif.ISO, exif.ExposureBias)
+			}
+
+			if exif.FocalLength != 50 || exif.FocalLength35mm != 50 {
+				t.Errorf("expected a focal length of 50mm, got %vmm (%dmm)", exif.FocalLength, exif.FocalLength35mm)
+			}
+
+			gps := exif.GPS
+			if gps == nil {
+				t.Fatal("expected GPS position, got nil")
+			}
+
+			if math.Abs(gps.Latitude+33.85990) > 1e-5 || math.Abs(gps.Longitude-151.20833) > 1e-5 {
+				t.Errorf("expected position -33.85990, 151.20833, got %v, %v", gps.Latitude, gps.Longitude)
+			}
+			if !gps.HasAltitude || gps.Altitude != -12 {
+				t.Errorf("expected an altitude of 12m below sea level, got %v (%t)", gps.Altitude, gps.HasAltitude)
+			}
+		})
+	}
+
+	t.Run("LocalTime", func(t *testing.T) {
+		order := binary.LittleEndian
+		exifIFD := []tiffTestEntry{tiffASCII(0x9003, "2023:07:14 18:30:05")}
+		gpsIFD := []tiffTestEntry{
+			tiffRationals(order, 0x0002, 5, 1, 0, 0, 1, 0, 1),
+			tiffRationals(order, 0x0004, 5, 2, 1, 0, 1, 0, 1),
+		}
+
+		info, err := jpeg.ExtractInfo(bytes.NewReader(exifFile(order, nil, exifIFD, gpsIFD)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.EXIF == nil || !info.EXIF.DateTimeOriginal.Equal(time.Date(2023, 7, 14, 18, 30, 5, 0, time.UTC)) || info.EXIF.HasTimeOffset {
+			t.Errorf("expected a local time given in UTC, got %+v", info.EXIF)
+		}
+
+		// A zero denominator of the degrees invalidates the position
+		if info.EXIF.GPS != nil {
+			t.Errorf("expected no GPS position, got %+v", info.EXIF.GPS)
+		}
+	})
+
+	t.Run("DecimalDegrees", func(t *testing.T) {
+		// Degrees with a fraction, minutes and seconds written as 0/0
+		order := binary.BigEndian
+		gpsIFD := []tiffTestEntry{
+			tiffRationals(order, 0x0002, 5, 488566, 10000, 0, 0, 0, 0),
+			tiffASCII(0x0003, "W"),
+			tiffRationals(order, 0x0004, 5, 23522, 10000, 0, 0, 30, 1),
+		}
+
+		info, err := jpeg.ExtractInfo(bytes.NewReader(exifFile(order, nil, nil, gpsIFD)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.EXIF == nil || info.EXIF.GPS == nil {
+			t.Fatalf("expected GPS position, got %+v", info.EXIF)
+		}
+
+		if gps := info.EXIF.GPS; math.Abs(gps.Latitude-48.8566) > 1e-9 || math.Abs(gps.Longitude+2.36053) > 1e-5 {
+			t.Errorf("expected position 48.8566, -2.36053, got %v, %v", gps.Latitude, gps.Longitude)
+		}
+	})
+
+	t.Run("EntryLimit", func(t *testing.T) {
+		order := binary.BigEndian
+
+		// IFD0 holds a GPS position, and its Exif and GPS pointers point back to it
+		ifd0 := []tiffTestEntry{
+			tiffASCII(0x0001, "N"),
+			tiffRationals(order, 0x0002, 5, 10, 1, 0, 1, 0, 1),
+			tiffASCII(0x0003, "E"),
+			tiffRationals(order, 0x0004, 5, 20, 1, 0, 1, 0, 1),
+			tiffLong(order, 0x8769, 8),
+			tiffLong(order, 0x8825, 8),
+		}
+
+		info, err := jpeg.ExtractInfo(bytes.NewReader(jpegFile(exifBlock(order, ifd0))))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.EXIF == nil || info.EXIF.GPS == nil || info.EXIF.GPS.Latitude != 10 || info.EXIF.GPS.Longitude != 20 {
+			t.Fatalf("expected the position of IFD0, got %+v", info.EXIF)
+		}
+
+		// Reading IFD0 three times exceeds the entries visited for large IFDs
+		for i := 0; len(ifd0) < 400; i++ {
+			ifd0 = append(ifd0, tiffShort(order, uint16(0xC000+i), 0))
+		}
+
+		info, err = jpeg.ExtractInfo(bytes.NewReader(jpegFile(exifBlock(order, ifd0))))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.EXIF == nil || info.EXIF.GPS != nil {
+			t.Errorf("expected no GPS position past the entry limit, got %+v", info.EXIF)
+		}
+	})
+
+	t.Run("NotRequested", func(t *testing.T) {
+		buf := jpegFile(exifBlock(binary.LittleEndian, []tiffTestEntry{tiffASCII(0x010F, "Canon")}))
+
+		info, err := extractor.JPEG{}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.EXIF != nil {
+			t.Errorf("expected no EXIF fields unless requested, got %+v", info.EXIF)
+		}
+	})
+}
@@ -1,5 +1,7 @@
 package extractor_test
 
+import "io"
+
 func mergeBuffers(buffers ...[]byte) []byte {
 	combined := make([]byte, 0)
 
@@ -9,3 +11,15 @@ func mergeBuffers(buffers ...[]byte) []byte {
 
 	return combined
 }
+
+// countingReader counts the bytes read through it, to check that skipped data is not read.
+type countingReader struct {
+	io.ReadSeeker
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadSeeker.Read(p)
+	r.read += n
+	return n, err
+}
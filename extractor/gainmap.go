@@ -0,0 +1,38 @@
+package extractor
+
+// GainMapSource tells how the gain map of an image is signalled.
+type GainMapSource uint8
+
+const (
+	// GainMapUltraHDR is a secondary image of the MPF index of a JPEG file
+	// whose primary image has XMP metadata in the hdrgm namespace (Android Ultra HDR).
+	GainMapUltraHDR GainMapSource = iota
+
+	// GainMapISO21496 is the second input of a tone map derived item (tmap) of a HEIF file, see ISO 21496-1.
+	GainMapISO21496
+
+	// GainMapApple is an auxiliary image of a HEIF file with the Apple HDR gain map type.
+	GainMapApple
+)
+
+func (s GainMapSource) String() string {
+	switch s {
+	case GainMapUltraHDR:
+		return "UltraHDR"
+	case GainMapISO21496:
+		return "ISO21496-1"
+	case GainMapApple:
+		return "Apple"
+	default:
+		return "Unknown"
+	}
+}
+
+// GainMap describes the gain map of an image, which maps the SDR base image to an HDR rendition.
+type GainMap struct {
+	Source GainMapSource
+
+	// Size of the gain map, usually smaller than the base image. Zero if it cannot be read.
+	Width  int
+	Height int
+}
@@ -1,15 +1,123 @@
 package extractor
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/pillowskiy/imagesize/imagebytes"
 	"github.com/pillowskiy/imagesize/imagerrors"
 )
 
-var gifHeader = []byte("\x47\x49\x46")
+var (
+	gif87aMagic = []byte("GIF87a")
+	gif89aMagic = []byte("GIF89a")
+)
+
+// GIF block introducers and extension labels.
+const (
+	gifImageDescriptor    = 0x2C
+	gifExtension          = 0x21
+	gifTrailer            = 0x3B
+	gifGraphicControl     = 0xF9
+	gifApplicationControl = 0xFF
+)
+
+// Size of the magic trailer of the XMP Application Extension, without the block terminator.
+const gifXMPTrailerSize = 257
+
+// GIFDisposal tells what happens to the area of a frame before the next frame is rendered.
+type GIFDisposal uint8
+
+const (
+	// GIFDisposalUnspecified leaves the disposal to the decoder, which usually keeps the frame.
+	GIFDisposalUnspecified GIFDisposal = iota
+
+	// GIFDisposalNone keeps the frame in place.
+	GIFDisposalNone
+
+	// GIFDisposalBackground clears the area of the frame to the background.
+	GIFDisposalBackground
+
+	// GIFDisposalPrevious restores the area of the frame to what it was before rendering it.
+	GIFDisposalPrevious
+)
+
+func (d GIFDisposal) String() string {
+	switch d {
+	case GIFDisposalUnspecified:
+		return "Unspecified"
+	case GIFDisposalNone:
+		return "None"
+	case GIFDisposalBackground:
+		return "Background"
+	case GIFDisposalPrevious:
+		return "Previous"
+	default:
+		return fmt.Sprintf("GIFDisposal(%d)", uint8(d))
+	}
+}
+
+// GIFFrame describes an image of a GIF file, along with its Graphic Control Extension.
+type GIFFrame struct {
+	// Position and size of the frame on the logical screen.
+	X      int
+	Y      int
+	Width  int
+	Height int
+
+	Interlaced bool
+
+	// Delay before the next frame, as stored. Browsers show frames with a delay below 20ms for 100ms.
+	Delay time.Duration
+
+	Disposal GIFDisposal
+
+	// Transparent reports that pixels of TransparentIndex are transparent.
+	Transparent      bool
+	TransparentIndex uint8
+}
+
+// GIFInfo contains the information extracted from a GIF file.
+type GIFInfo struct {
+	// Size of the logical screen.
+	Width  int
+	Height int
+
+	// Version of the format, "87a" or "89a".
+	Version string
+
+	// Number of entries of the global color table, 0 if there is none.
+	GlobalColorTableSize int
+
+	// SortedColorTable reports that the global color table is sorted by decreasing importance.
+	SortedColorTable bool
+
+	// Bits per primary color of the original image, minus 1 (0-7).
+	ColorResolution uint8
+
+	// Index of the background color in the global color table.
+	BackgroundIndex uint8
+
+	// Width to height ratio of a pixel, 0 if unspecified, in which case pixels are square.
+	// The display aspect ratio of the image is Width*PixelAspectRatio/Height.
+	PixelAspectRatio float64
+
+	// Animation of the file, read with GIF.ReadFrames and nil otherwise. Still images have a single frame.
+	// Files without a NETSCAPE2.0 loop extension are played once, files with a loop count of N
+	// are played N+1 times, and a loop count of 0 means infinitely.
+	Animation *Animation
+
+	// Frames in file order, read with GIF.ReadFrames.
+	Frames []GIFFrame
+
+	// XMP packet of the "XMP DataXMP" Application Extension, read with GIF.ReadXMP.
+	// Nil otherwise or when the file has none.
+	XMP *XMP
+}
 
 // GIF defines an extractor for the GIF image format.
 //
@@ -20,23 +128,340 @@ var gifHeader = []byte("\x47\x49\x46")
 // After the header, the GIF file contains the Logical Screen Descriptor (LSD), which specifies the width and height of the image in pixels:
 // 3. The next 2 bytes represent the width of the image (unsigned 16-bit integer, little-endian).
 // 4. The following 2 bytes represent the height of the image (unsigned 16-bit integer, little-endian).
-type GIF struct{}
+// 5. The next byte packs the global color table flag (1 bit), the color resolution (3 bits),
+// the sort flag (1 bit) and the size of the global color table (3 bits).
+// 6. The last 2 bytes are the background color index and the pixel aspect ratio.
+//
+// The LSD is followed by the global color table, if any, and by a sequence of image descriptors and extensions,
+// whose data is split into sub-blocks of up to 255 bytes.
+// See https://www.w3.org/Graphics/GIF/spec-gif89a.txt
+type GIF struct {
+	// ReadFrames walks the blocks of the file, skipping color tables and image data without decoding them,
+	// to report the frames, the loop count and the total duration.
+	ReadFrames bool
+
+	// ReadXMP walks the blocks of the file up to the XMP Application Extension, see GIFInfo.XMP.
+	ReadXMP bool
+}
 
 func (e GIF) BufSize() int {
-	return len(gifHeader)
+	return len(gif89aMagic)
 }
 
 func (e GIF) MatchFormat(buf []byte) (string, bool) {
-	return "gif", bytes.HasPrefix(buf, gifHeader)
+	return "gif", bytes.HasPrefix(buf, gif87aMagic) || bytes.HasPrefix(buf, gif89aMagic)
 }
 
 func (e GIF) ExtractSize(reader io.ReadSeeker) (width, height int, err error) {
-	if _, err = reader.Seek(6, io.SeekStart); err != nil {
-		err = fmt.Errorf("failed to seek: %w", err)
+	info, err := e.ExtractInfo(reader)
+	if err != nil {
+		return
+	}
+
+	return info.Width, info.Height, nil
+}
+
+// ExtractDetails implements imagesize.DetailsExtractor, the details are of type *GIFInfo.
+func (e GIF) ExtractDetails(reader io.ReadSeeker) (width, height int, details interface{}, err error) {
+	info, err := e.ExtractInfo(reader)
+	if err != nil {
 		return
 	}
 
+	return info.Width, info.Height, info, nil
+}
+
+// ExtractInfo validates the header and extracts the Logical Screen Descriptor and, with ReadFrames, the frames of the file.
+func (e GIF) ExtractInfo(reader io.ReadSeeker) (*GIFInfo, error) {
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek: %w", err)
+	}
+
+	var magic [6]byte
+	if _, err := io.ReadFull(reader, magic[:]); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if _, ok := e.MatchFormat(magic[:]); !ok {
+		return nil, fmt.Errorf("unsupported GIF version %q", magic[3:])
+	}
+
 	widthU16, widthErr := imagebytes.ReadU16(reader, imagebytes.LittleEndian)
 	heightU16, heightErr := imagebytes.ReadU16(reader, imagebytes.LittleEndian)
-	return int(widthU16), int(heightU16), imagerrors.Join(widthErr, heightErr)
+	if err := imagerrors.Join(widthErr, heightErr); err != nil {
+		return nil, err
+	}
+
+	// Packed fields, background color index and pixel aspect ratio
+	var fields [3]byte
+	if _, err := io.ReadFull(reader, fields[:]); err != nil {
+		return nil, fmt.Errorf("corrupted image: truncated logical screen descriptor: %w", err)
+	}
+
+	packed := fields[0]
+	info := &GIFInfo{
+		Width:            int(widthU16),
+		Height:           int(heightU16),
+		Version:          string(magic[3:]),
+		SortedColorTable: packed&0x08 != 0,
+		ColorResolution:  packed >> 4 & 0x07,
+		BackgroundIndex:  fields[1],
+	}
+
+	if packed&0x80 != 0 {
+		info.GlobalColorTableSize = 2 << (packed & 0x07)
+	}
+
+	// Pixel aspect ratio as (N + 15) / 64, for ratios from 1:4 to 4:1
+	if fields[2] != 0 {
+		info.PixelAspectRatio = (float64(fields[2]) + 15) / 64
+	}
+
+	if !e.ReadFrames && !e.ReadXMP {
+		return info, nil
+	}
+
+	// Image data is skipped in many small sub-blocks, which are cheaper to discard from a buffer than to seek over
+	buffered := bufio.NewReader(reader)
+	if err := e.skipColorTable(buffered, packed); err != nil {
+		return nil, fmt.Errorf("failed to skip global color table: %w", err)
+	}
+
+	if err := e.readBlocks(buffered, info); err != nil {
+		return nil, err
+	}
+
+	if !e.ReadFrames {
+		info.Animation, info.Frames = nil, nil
+	}
+	return info, nil
+}
+
+// Walks the blocks following the Logical Screen Descriptor up to the trailer, or up to the XMP packet without ReadFrames.
+// A file ending early or with an unknown block is not an error, as decoders display the frames read so far.
+func (e GIF) readBlocks(reader *bufio.Reader, info *GIFInfo) error {
+	info.Animation = &Animation{LoopCount: 1}
+
+	// Graphic Control Extension applying to the next image
+	var control *GIFFrame
+	for {
+		introducer, err := reader.ReadByte()
+		if err != nil {
+			if isEOF(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to read block: %w", err)
+		}
+
+		switch introducer {
+		case gifTrailer:
+			return nil
+		case gifImageDescriptor:
+			frame := GIFFrame{}
+			if control != nil {
+				frame = *control
+				control = nil
+			}
+
+			if err := e.readImage(reader, &frame); err != nil {
+				return ignoreEOF(err)
+			}
+
+			info.Frames = append(info.Frames, frame)
+			info.Animation.Frames++
+			info.Animation.Duration += frame.Delay
+		case gifExtension:
+			label, err := reader.ReadByte()
+			if err != nil {
+				return ignoreEOF(err)
+			}
+
+			switch label {
+			case gifGraphicControl:
+				control = new(GIFFrame)
+				err = e.readGraphicControl(reader, control)
+			case gifApplicationControl:
+				err = e.readApplication(reader, info)
+			default:
+				err = e.skipSubBlocks(reader)
+			}
+			if err != nil {
+				return ignoreEOF(err)
+			}
+
+			if info.XMP != nil && !e.ReadFrames {
+				return nil
+			}
+		default:
+			// Unknown blocks, such as trailing garbage, end the image like the trailer
+			return nil
+		}
+	}
+}
+
+// Reads an image descriptor: left, top, width and height (2 each) and packed fields (1),
+// then skips the local color table and the image data.
+func (e GIF) readImage(reader *bufio.Reader, frame *GIFFrame) error {
+	var descriptor [9]byte
+	if _, err := io.ReadFull(reader, descriptor[:]); err != nil {
+		return fmt.Errorf("failed to read image descriptor: %w", err)
+	}
+
+	frame.X = int(uint16(descriptor[0]) | uint16(descriptor[1])<<8)
+	frame.Y = int(uint16(descriptor[2]) | uint16(descriptor[3])<<8)
+	frame.Width = int(uint16(descriptor[4]) | uint16(descriptor[5])<<8)
+	frame.Height = int(uint16(descriptor[6]) | uint16(descriptor[7])<<8)
+	frame.Interlaced = descriptor[8]&0x40 != 0
+
+	if err := e.skipColorTable(reader, descriptor[8]); err != nil {
+		return fmt.Errorf("failed to skip local color table: %w", err)
+	}
+
+	// LZW minimum code size precedes the image data
+	if _, err := reader.ReadByte(); err != nil {
+		return fmt.Errorf("failed to read image data: %w", err)
+	}
+	return e.skipSubBlocks(reader)
+}
+
+// Reads a Graphic Control Extension: block size (1, always 4), packed fields (1), delay in hundredths
+// of a second (2) and transparent color index (1).
+func (e GIF) readGraphicControl(reader *bufio.Reader, frame *GIFFrame) error {
+	var block [5]byte
+	if _, err := io.ReadFull(reader, block[:]); err != nil {
+		return fmt.Errorf("failed to read graphic control extension: %w", err)
+	}
+	if block[0] != 4 {
+		return errors.New("corrupted image: invalid graphic control extension size")
+	}
+
+	frame.Disposal = GIFDisposal(block[1] >> 2 & 0x07)
+	frame.Transparent = block[1]&0x01 != 0
+	frame.Delay = time.Duration(uint16(block[2])|uint16(block[3])<<8) * 10 * time.Millisecond
+	frame.TransparentIndex = block[4]
+
+	return e.skipSubBlocks(reader)
+}
+
+// Reads an Application Extension, looking for the loop count of the NETSCAPE2.0 (or ANIMEXTS1.0) extension:
+// a sub-block made of the 0x01 identifier and the loop count (2), and for the XMP packet.
+func (e GIF) readApplication(reader *bufio.Reader, info *GIFInfo) error {
+	var block [12]byte
+	if _, err := io.ReadFull(reader, block[:]); err != nil {
+		return fmt.Errorf("failed to read application extension: %w", err)
+	}
+
+	if block[0] != 11 {
+		return errors.New("corrupted image: invalid application extension size")
+	}
+
+	// Application identifier (8) and authentication code (3)
+	identifier := string(block[1:12])
+	if identifier == "XMP DataXMP" && e.ReadXMP && info.XMP == nil {
+		return e.readXMP(reader, info)
+	}
+	if identifier != "NETSCAPE2.0" && identifier != "ANIMEXTS1.0" {
+		return e.skipSubBlocks(reader)
+	}
+
+	for {
+		size, err := reader.ReadByte()
+		if err != nil || size == 0 {
+			return err
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return fmt.Errorf("failed to read application extension: %w", err)
+		}
+
+		if size >= 3 && data[0] == 0x01 {
+			loops := int(uint16(data[1]) | uint16(data[2])<<8)
+			info.Animation.LoopCount = 0
+			if loops > 0 {
+				info.Animation.LoopCount = loops + 1
+			}
+		}
+	}
+}
+
+// Reads the XMP packet of the XMP Application Extension, which is stored as is rather than split
+// into sub-blocks: readers going through sub-blocks take its bytes as sizes, and land on the block
+// terminator thanks to a "magic trailer" made of 0x01 followed by 0xFF down to 0x00.
+func (e GIF) readXMP(reader *bufio.Reader, info *GIFInfo) error {
+	var packet []byte
+	for {
+		size, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			break
+		}
+
+		if len(packet)+1+int(size) > maxXMPSize {
+			return e.skipSubBlocks(reader)
+		}
+
+		start := len(packet)
+		packet = append(packet, make([]byte, 1+int(size))...)
+		packet[start] = size
+		if _, err := io.ReadFull(reader, packet[start+1:]); err != nil {
+			return fmt.Errorf("failed to read XMP application extension: %w", err)
+		}
+	}
+
+	if end := len(packet) - gifXMPTrailerSize; end >= 0 && isGIFXMPTrailer(packet[end:]) {
+		packet = packet[:end]
+	}
+	info.XMP = newXMP(packet)
+	return nil
+}
+
+// Reports whether the bytes are the magic trailer of the XMP Application Extension.
+func isGIFXMPTrailer(trailer []byte) bool {
+	if trailer[0] != 0x01 {
+		return false
+	}
+	for i, b := range trailer[1:] {
+		if b != byte(0xFF-i) {
+			return false
+		}
+	}
+	return true
+}
+
+// Skips the color table announced by packed fields of the LSD or of an image descriptor:
+// the table is present if the highest bit is set, and holds 2^(N+1) RGB entries for the lowest 3 bits N.
+func (e GIF) skipColorTable(reader *bufio.Reader, packed byte) error {
+	if packed&0x80 == 0 {
+		return nil
+	}
+
+	_, err := reader.Discard(3 << (packed&0x07 + 1))
+	return err
+}
+
+// Skips data sub-blocks up to the block terminator, a sub-block of size 0.
+func (e GIF) skipSubBlocks(reader *bufio.Reader) error {
+	for {
+		size, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+
+		if _, err := reader.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// Returns nil for errors telling that the data ended early.
+func ignoreEOF(err error) error {
+	if isEOF(err) {
+		return nil
+	}
+	return err
 }
@@ -2,25 +2,36 @@ package extractor_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/pillowskiy/imagesize/extractor"
 )
 
+func le16(v uint16) []byte {
+	buf := make([]byte, 2)
+	binary.LittleEndian.PutUint16(buf, v)
+	return buf
+}
+
 func TestGIF(t *testing.T) {
 	t.Parallel()
-	extractor := extractor.GIF{}
+	gif := extractor.GIF{}
 
 	var (
 		gifHeader        = []byte("GIF")
 		gifVersionHeader = []byte("89a")
-		gifWidth         = []byte{0x01, 0x00} // 1
-		gifHeight        = []byte{0x02, 0x00} // 2
+		gifWidth         = []byte{0x01, 0x00}       // 1
+		gifHeight        = []byte{0x02, 0x00}       // 2
+		gifScreenFields  = []byte{0x00, 0x00, 0x00} // No global color table, background index 0, square pixels
 	)
 
 	t.Run("BufferSizeMatchesGIFHeaderLength", func(t *testing.T) {
-		bufSize := extractor.BufSize()
-		expectedBufSize := len(gifHeader)
+		bufSize := gif.BufSize()
+		expectedBufSize := len(gifHeader) + len(gifVersionHeader)
 
 		if bufSize != expectedBufSize {
 			t.Errorf("expected buf size %d, got %d", expectedBufSize, bufSize)
@@ -31,10 +42,11 @@ func TestGIF(t *testing.T) {
 		gifHeader,
 		gifVersionHeader,
 		gifWidth, gifHeight,
+		gifScreenFields,
 	)
 
 	t.Run("FormatDetection", func(t *testing.T) {
-		format, matched := extractor.MatchFormat(validGIF)
+		format, matched := gif.MatchFormat(validGIF)
 		if !matched {
 			t.Error("expected match for valid GIF file")
 		}
@@ -47,7 +59,7 @@ func TestGIF(t *testing.T) {
 
 	t.Run("ExtractSizeFromValidImage", func(t *testing.T) {
 		reader := bytes.NewReader(validGIF)
-		width, height, err := extractor.ExtractSize(reader)
+		width, height, err := gif.ExtractSize(reader)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -61,6 +73,220 @@ func TestGIF(t *testing.T) {
 		}
 	})
 
+	t.Run("ExtractLogicalScreenDescriptor", func(t *testing.T) {
+		buf := mergeBuffers(gifHeader, []byte("87a"), gifWidth, gifHeight, []byte{0xDA, 0x05, 0x31}, make([]byte, 24))
+
+		info, err := gif.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := extractor.GIFInfo{
+			Width:                1,
+			Height:               2,
+			Version:              "87a",
+			GlobalColorTableSize: 8,
+			SortedColorTable:     true,
+			ColorResolution:      5,
+			BackgroundIndex:      5,
+			PixelAspectRatio:     1,
+		}
+		if !reflect.DeepEqual(*info, expected) {
+			t.Errorf("expected %+v, got %+v", expected, *info)
+		}
+	})
+
+	t.Run("InvalidVersion", func(t *testing.T) {
+		buf := mergeBuffers([]byte("GIFT: a text file"), make([]byte, 8))
+
+		if _, matched := gif.MatchFormat(buf); matched {
+			t.Error("expected no match for unknown version")
+		}
+
+		if _, _, err := gif.ExtractSize(bytes.NewReader(buf)); err == nil {
+			t.Fatal("expected error due to unknown version, got nil")
+		}
+	})
+
+	t.Run("TruncatedLogicalScreenDescriptor", func(t *testing.T) {
+		buf := mergeBuffers(gifHeader, gifVersionHeader, gifWidth, gifHeight, []byte{0x00})
+
+		if _, _, err := gif.ExtractSize(bytes.NewReader(buf)); err == nil {
+			t.Fatal("expected error due to truncated logical screen descriptor, got nil")
+		}
+	})
+
+	t.Run("ReadFrames", func(t *testing.T) {
+		buf, err := os.ReadFile("../_testdata/gif/200x200.gif")
+		if err != nil {
+			t.Fatalf("failed to read test file: %v", err)
+		}
+
+		info, err := extractor.GIF{ReadFrames: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := extractor.Animation{Frames: 2, LoopCount: 0, Duration: 60 * time.Millisecond}
+		if info.Animation == nil || *info.Animation != expected {
+			t.Fatalf("expected animation %+v, got %+v", expected, info.Animation)
+		}
+
+		frame := extractor.GIFFrame{Width: 200, Height: 200, Delay: 30 * time.Millisecond, Disposal: extractor.GIFDisposalBackground, Transparent: true}
+		if len(info.Frames) != 2 || info.Frames[1] != frame {
+			t.Errorf("expected second frame %+v, got %+v", frame, info.Frames)
+		}
+
+		// Frames are only read on request
+		info, err = gif.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Animation != nil || info.Frames != nil {
+			t.Errorf("expected no frames, got %+v", info)
+		}
+	})
+
+	t.Run("ReadFramesOfSyntheticImage", func(t *testing.T) {
+		image := func(x, y, width, height uint16, packed byte, table ...byte) []byte {
+			return mergeBuffers(
+				[]byte{0x2C}, le16(x), le16(y), le16(width), le16(height), []byte{packed}, table,
+				[]byte{0x02, 0x02, 0x4C, 0x01, 0x00}, // LZW code size and a single sub-block
+			)
+		}
+
+		graphicControl := func(packed byte, delay uint16, transparentIndex byte) []byte {
+			return mergeBuffers([]byte{0x21, 0xF9, 0x04, packed}, le16(delay), []byte{transparentIndex, 0x00})
+		}
+
+		loop := func(count uint16) []byte {
+			return mergeBuffers([]byte{0x21, 0xFF, 0x0B}, []byte("NETSCAPE2.0"), []byte{0x03, 0x01}, le16(count), []byte{0x00})
+		}
+
+		screen := mergeBuffers(gifHeader, gifVersionHeader, le16(10), le16(10), []byte{0x80, 0x00, 0x00}, make([]byte, 6))
+		comment := mergeBuffers([]byte{0x21, 0xFE, 0x03}, []byte("abc"), []byte{0x00})
+
+		tests := []struct {
+			name      string
+			buf       []byte
+			frames    []extractor.GIFFrame
+			loopCount int
+		}{
+			{
+				name:      "StillImage",
+				buf:       mergeBuffers(screen, image(0, 0, 10, 10, 0x00), []byte{0x3B}),
+				frames:    []extractor.GIFFrame{{Width: 10, Height: 10}},
+				loopCount: 1,
+			},
+			{
+				name: "LoopedAnimation",
+				buf: mergeBuffers(screen, loop(2), comment,
+					graphicControl(0x0D, 5, 3), image(1, 2, 3, 4, 0xC1, make([]byte, 12)...),
+					graphicControl(0x04, 7, 0), image(0, 0, 10, 10, 0x00),
+					[]byte{0x3B},
+				),
+				frames: []extractor.GIFFrame{
+					{
+						X: 1, Y: 2, Width: 3, Height: 4, Interlaced: true, Delay: 50 * time.Millisecond,
+						Disposal: extractor.GIFDisposalPrevious, Transparent: true, TransparentIndex: 3,
+					},
+					{Width: 10, Height: 10, Delay: 70 * time.Millisecond, Disposal: extractor.GIFDisposalNone},
+				},
+				loopCount: 3,
+			},
+			{
+				name:      "Truncated",
+				buf:       mergeBuffers(screen, image(0, 0, 10, 10, 0x00), graphicControl(0x00, 5, 0), []byte{0x2C, 0x00}),
+				frames:    []extractor.GIFFrame{{Width: 10, Height: 10}},
+				loopCount: 1,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				info, err := extractor.GIF{ReadFrames: true}.ExtractInfo(bytes.NewReader(tt.buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if len(info.Frames) != len(tt.frames) {
+					t.Fatalf("expected %d frames, got %+v", len(tt.frames), info.Frames)
+				}
+
+				var duration time.Duration
+				for i, frame := range tt.frames {
+					if info.Frames[i] != frame {
+						t.Errorf("expected frame %d to be %+v, got %+v", i, frame, info.Frames[i])
+					}
+					duration += frame.Delay
+				}
+
+				if info.Animation.Frames != len(tt.frames) || info.Animation.LoopCount != tt.loopCount || info.Animation.Duration != duration {
+					t.Errorf("expected %d frames played %d times for %v, got %+v", len(tt.frames), tt.loopCount, duration, info.Animation)
+				}
+			})
+		}
+	})
+
+	t.Run("ReadXMP", func(t *testing.T) {
+		packet := xmpPacket(`xmp:Rating="2"`, "")
+
+		trailer := []byte{0x01}
+		for i := 0xFF; i >= 0; i-- {
+			trailer = append(trailer, byte(i))
+		}
+		xmp := mergeBuffers([]byte{0x21, 0xFF, 0x0B}, []byte("XMP DataXMP"), packet, trailer, []byte{0x00})
+		image := []byte{0x2C, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x4C, 0x01, 0x00}
+		buf := mergeBuffers(validGIF, xmp, image, []byte{0x3B})
+
+		info, err := extractor.GIF{ReadXMP: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP == nil || !bytes.Equal(info.XMP.Packet, packet) || info.XMP.Properties["xmp:Rating"] != "2" {
+			t.Errorf("expected the packet without its magic trailer, got %+v", info.XMP)
+		}
+
+		if info.Animation != nil || info.Frames != nil {
+			t.Errorf("expected no frames unless requested, got %+v", info)
+		}
+
+		info, err = extractor.GIF{ReadFrames: true, ReadXMP: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP == nil || len(info.Frames) != 1 {
+			t.Errorf("expected the packet and a frame, got %+v", info)
+		}
+
+		info, err = extractor.GIF{ReadFrames: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP != nil || len(info.Frames) != 1 {
+			t.Errorf("expected a frame without XMP unless requested, got %+v", info)
+		}
+	})
+
+	t.Run("UnknownBlock", func(t *testing.T) {
+		// Trailing garbage after a 1x1 frame
+		image := []byte{0x2C, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x4C, 0x01, 0x00}
+		buf := mergeBuffers(validGIF, image, []byte{0x42}, image)
+
+		info, err := extractor.GIF{ReadFrames: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(info.Frames) != 1 || info.Animation == nil || info.Animation.Frames != 1 {
+			t.Errorf("expected the frame preceding the unknown block, got %+v", info)
+		}
+	})
+
 	t.Run("CorruptedImage", func(t *testing.T) {
 		invalidGIF := mergeBuffers(
 			gifHeader,
@@ -69,7 +295,7 @@ func TestGIF(t *testing.T) {
 		)
 
 		reader := bytes.NewReader(invalidGIF)
-		_, _, err := extractor.ExtractSize(reader)
+		_, _, err := gif.ExtractSize(reader)
 
 		if err == nil {
 			t.Fatalf("expected error due to missing height, got nil")
@@ -78,7 +304,7 @@ func TestGIF(t *testing.T) {
 
 	t.Run("BufferSizeMatchesJPEGHeaderLength", func(t *testing.T) {
 		nonGIF := []byte("NOTGIFHEADER")
-		_, matched := extractor.MatchFormat(nonGIF)
+		_, matched := gif.MatchFormat(nonGIF)
 
 		if matched {
 			t.Error("expected no match for non-GIF file")
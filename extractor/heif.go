@@ -2,12 +2,11 @@ package extractor
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"image"
 	"io"
-
-	"github.com/pillowskiy/imagesize/imagebytes"
-	"github.com/pillowskiy/imagesize/imagerrors"
 )
 
 var ftypHeader = []byte("ftyp")
@@ -16,6 +15,7 @@ const (
 	hevcBrandKey uint8 = 1
 	av1BrandKey  uint8 = 2
 	jpegBrandKey uint8 = 3
+	j2kBrandKey  uint8 = 4
 )
 
 var ftypCompatibleBrandsMap = map[string]struct{}{
@@ -43,125 +43,783 @@ var brandsKeyMap = map[string]uint8{
 
 	"jpeg": jpegBrandKey,
 	"jpgs": jpegBrandKey,
+
+	"j2ki": j2kBrandKey,
+	"j2is": j2kBrandKey,
+}
+
+// Derived image item types, their codec is the codec of their input images.
+var heifDerivedItemTypes = map[string]struct{}{
+	"grid": {},
+	"iovl": {},
+	"iden": {},
+	"tmap": {},
+}
+
+// Auxiliary type URNs of alpha and depth planes, both the MPEG-B and the legacy HEVC variants.
+var (
+	heifAlphaAuxTypes = map[string]struct{}{
+		"urn:mpeg:mpegB:cicp:systems:auxiliary:alpha": {},
+		"urn:mpeg:hevc:2015:auxid:1":                  {},
+	}
+	heifDepthAuxTypes = map[string]struct{}{
+		"urn:mpeg:mpegB:cicp:systems:auxiliary:depth": {},
+		"urn:mpeg:hevc:2015:auxid:2":                  {},
+	}
+)
+
+// Auxiliary type URN of Apple HDR gain maps.
+const heifAppleGainMapAuxType = "urn:com:apple:photo:2020:aux:hdrgainmap"
+
+// HEIFItemRole describes how an item relates to the rest of the HEIF file.
+type HEIFItemRole uint8
+
+const (
+	// HEIFRoleOther is an item which is not referenced in a known way.
+	HEIFRoleOther HEIFItemRole = iota
+
+	// HEIFRolePrimary is the item that should be displayed by default (pitm).
+	HEIFRolePrimary
+
+	// HEIFRoleThumbnail is a smaller version of another item (thmb reference).
+	HEIFRoleThumbnail
+
+	// HEIFRoleAlpha is an auxiliary alpha plane (auxl reference).
+	HEIFRoleAlpha
+
+	// HEIFRoleDepth is an auxiliary depth map (auxl reference).
+	HEIFRoleDepth
+
+	// HEIFRoleAuxiliary is any other auxiliary image (auxl reference).
+	HEIFRoleAuxiliary
+
+	// HEIFRoleTile is an input of a derived image such as a grid (dimg reference).
+	HEIFRoleTile
+
+	// HEIFRoleMetadata describes another item, e.g. Exif or XMP (cdsc reference).
+	HEIFRoleMetadata
+
+	// HEIFRoleGainMap is a gain map, either the second input of a tone map derived item (tmap)
+	// or an Apple HDR gain map auxiliary image (auxl reference).
+	HEIFRoleGainMap
+)
+
+func (r HEIFItemRole) String() string {
+	switch r {
+	case HEIFRolePrimary:
+		return "primary"
+	case HEIFRoleThumbnail:
+		return "thumbnail"
+	case HEIFRoleAlpha:
+		return "alpha"
+	case HEIFRoleDepth:
+		return "depth"
+	case HEIFRoleAuxiliary:
+		return "auxiliary"
+	case HEIFRoleTile:
+		return "tile"
+	case HEIFRoleMetadata:
+		return "metadata"
+	case HEIFRoleGainMap:
+		return "gain map"
+	default:
+		return "other"
+	}
+}
+
+// HEIFItem describes a single item of a HEIF file.
+type HEIFItem struct {
+	ID uint32
+
+	// Four character code of the item type ("hvc1", "av01", "grid", "Exif", ...).
+	Type string
+	Name string
+	Role HEIFItemRole
+
+	// ID of the item this one refers to (the master image of a thumbnail or an auxiliary image,
+	// the derived image of a tile, the described item of metadata), 0 if none.
+	RefItemID uint32
+
+	// URN from the auxC property of auxiliary images.
+	AuxiliaryType string
+
+	// Hidden items are not intended to be displayed on their own.
+	Hidden bool
+
+	// Coded size from the ispe property, zero for items without one.
+	Width  int
+	Height int
+
+	// Size after applying the transformative properties of the item.
+	DisplayWidth  int
+	DisplayHeight int
+
+	// Transformative properties (clap, irot, imir) in the order they are applied, as listed in ipma.
+	Transformations []HEIFTransformation
+
+	// Decoded codec configuration of coded items, set with HEIF.DecodeCodecConfig.
+	// Nil when the item has no configuration or when it cannot be decoded.
+	CodecConfig *HEIFCodecConfig
 }
 
+// HEIFTransformation describes a transformative property of an item.
+type HEIFTransformation struct {
+	// Property type: "clap", "irot" or "imir".
+	Type string
+
+	// Anti-clockwise rotation in degrees (0, 90, 180 or 270), set for irot.
+	Angle int
+
+	// Mirroring axis, set for imir: 0 mirrors about a vertical axis (left-right),
+	// 1 mirrors about a horizontal axis (top-bottom).
+	Axis uint8
+
+	// Clean aperture, set for clap, in the coordinates of the image the transformation is applied to.
+	Crop image.Rectangle
+}
+
+// HEIFInfo contains the information extracted from a HEIF file.
+type HEIFInfo struct {
+	// Display size of the primary item.
+	Width  int
+	Height int
+
+	Primary HEIFItem
+
+	// All items except the primary one, in iinf order.
+	Items []HEIFItem
+
+	// Largest reports that the primary item could not be resolved and the size was taken
+	// from the largest ispe property instead, see HEIF.FallbackToLargest.
+	Largest bool
+
+	// Picture track of image sequences (moov box), only read when the size is taken from it.
+	// Nil for still images and for sequences whose primary item was reported instead.
+	Sequence *HEIFSequence
+
+	// FromSequence reports that the size was taken from the display size of the sequence track
+	// instead of the primary item, either because the file has no meta box or due to HEIF.PreferSequence.
+	// The primary item is also reported when the sequence cannot be read, and the other way around.
+	FromSequence bool
+
+	// Orientation of the Exif item describing the primary item. It is informative only:
+	// the display size is given by the irot and imir properties, which may disagree with it,
+	// so DisplayWidth and DisplayHeight always equal Width and Height.
+	OrientedSize
+
+	// Resolution from the Exif item describing the primary item.
+	Resolution
+
+	// Gain map of the file, nil if it has none.
+	GainMap *GainMap
+
+	// ICC profile and code points of the colr properties of the primary item, or of its first input
+	// for derived images without any, read with HEIF.ReadColorProfile. Nil otherwise or when there is none.
+	ColorProfile *ColorProfile
+
+	// XMP packet of the mime item describing the primary item, or of the first XMP item if none refers to it,
+	// read with HEIF.ReadXMP. Nil otherwise or when there is none.
+	XMP *XMP
+}
+
+// HDRGainMap implements imagesize.GainMapDetails.
+func (i *HEIFInfo) HDRGainMap() *GainMap {
+	return i.GainMap
+}
+
+// Codec returns the item type of the primary image ("hvc1", "av01", "jpeg", "j2k1", "unci", ...),
+// or of the inputs of a derived primary image such as a grid.
+// For sizes taken from a sequence, it is the sample entry type of the track.
+func (i *HEIFInfo) Codec() string {
+	if i.FromSequence && i.Sequence != nil {
+		return i.Sequence.Codec
+	}
+
+	if _, derived := heifDerivedItemTypes[i.Primary.Type]; !derived {
+		return i.Primary.Type
+	}
+
+	for _, item := range i.Items {
+		if item.Role == HEIFRoleTile && item.RefItemID == i.Primary.ID {
+			return item.Type
+		}
+	}
+	return i.Primary.Type
+}
+
+// HEIF defines an extractor for HEIF based image formats (HEIC, AVIF).
+//
+// The image size is taken from the ispe property associated with the primary item (pitm),
+// using the item information (iinf), item references (iref) and property associations (ipma) of the meta box.
+// Image sequences and animated AVIFs additionally describe their frames in a picture track of the moov box,
+// which is used when there is no meta box or when its primary item cannot be resolved.
+//
 // See:
 //   - https://en.wikipedia.org/wiki/High_Efficiency_Image_File_Format
 //   - https://github.com/nokiatech/heif
-type HEIF struct{}
+type HEIF struct {
+	// FallbackToLargest reports the largest ispe property by area when the primary item
+	// or its ispe property cannot be resolved, instead of returning an error.
+	FallbackToLargest bool
+
+	// PreferSequence reports the size of the picture track of image sequences and animated AVIFs,
+	// even when the file also contains a primary image item.
+	PreferSequence bool
+
+	// DecodeCodecConfig decodes the HEVC SPS (hvcC) or AV1 sequence header (av1C) of coded items
+	// to verify their ispe size, which is used for items that have no ispe property.
+	// Configurations that cannot be decoded are ignored, unless the primary item has no ispe property.
+	DecodeCodecConfig bool
+
+	// ReadColorProfile reads the colr properties of the primary item, see HEIFInfo.ColorProfile.
+	ReadColorProfile bool
+
+	// ReadXMP reads the XMP packet of the mime items, see HEIFInfo.XMP.
+	ReadXMP bool
+}
 
 func (e HEIF) ExtractSize(reader io.ReadSeeker) (width, height int, err error) {
-	if _, err = reader.Seek(0, io.SeekStart); err != nil {
+	info, err := e.ExtractInfo(reader)
+	if err != nil {
 		return
 	}
 
-	// Read the ftyp header size
-	ftypSize, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+	return info.Width, info.Height, nil
+}
+
+// ExtractDetails implements imagesize.DetailsExtractor, the details are of type *HEIFInfo.
+func (e HEIF) ExtractDetails(reader io.ReadSeeker) (width, height int, details interface{}, err error) {
+	info, err := e.ExtractInfo(reader)
 	if err != nil {
-		err = fmt.Errorf("failed to read ftyp header size: %w", err)
 		return
 	}
 
-	// Jump to the first actual box offset
-	if _, err = reader.Seek(int64(ftypSize), io.SeekStart); err != nil {
-		return
-	}
+	return info.Width, info.Height, info, nil
+}
 
-	// Skip to meta tag
-	if _, err = e.skipToTag(reader, []byte("meta")); err != nil {
-		return
+// ExtractInfo extracts the size of the primary item along with the other items of the file,
+// and the picture track for image sequences.
+func (e HEIF) ExtractInfo(reader io.ReadSeeker) (*HEIFInfo, error) {
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		return nil, err
 	}
 
-	// Discard the junk value after meta tag
-	if _, err = reader.Seek(4, io.SeekCurrent); err != nil {
-		return
+	metaPayload, moovOffset, err := e.readTopLevelBoxes(reader)
+	if err != nil {
+		return nil, err
 	}
 
-	// Skip to iprp tag
-	if _, err = e.skipToTag(reader, []byte("iprp")); err != nil {
-		return
+	if metaPayload == nil {
+		if moovOffset < 0 {
+			return nil, errors.New("failed to find meta box")
+		}
+		return e.fromSequence(reader, moovOffset)
 	}
 
-	// Find ipco tag
-	ipcoSizeU32, err := e.skipToTag(reader, []byte("ipco"))
-	if err != nil {
-		return
+	// The picture track is best-effort alongside a meta box, it is only read when the size is taken from it
+	if moovOffset >= 0 && e.PreferSequence {
+		if info, err := e.fromSequence(reader, moovOffset); err == nil {
+			return info, nil
+		}
 	}
-	ipcoSize := int(ipcoSizeU32)
 
-	// Keep track of the max size of ipco tag
-	var maxWidth, maxHeight int
-	foundIspe := false
-	var rotation uint8
+	info, err := e.extractItems(reader, metaPayload)
+	if err != nil && moovOffset >= 0 && !e.PreferSequence {
+		if info, sequenceErr := e.fromSequence(reader, moovOffset); sequenceErr == nil {
+			return info, nil
+		}
+	}
+	return info, err
+}
 
-	// Loop through all tags within ipco
+// Walks the top-level boxes, reads the payload of the meta box and locates the moov box, if any.
+// The moov box is not read here: it holds the sample tables of every track and can be large.
+func (e HEIF) readTopLevelBoxes(reader io.ReadSeeker) (meta []byte, moovOffset int64, err error) {
+	moovOffset = -1
 	for {
-		tag, size, tagErr := imagebytes.ReadTag(reader)
-		if tagErr != nil {
-			err = tagErr
+		offset, seekErr := reader.Seek(0, io.SeekCurrent)
+		if seekErr != nil {
+			err = seekErr
 			return
 		}
 
-		// Size of tag length + tag cannot be under 8 (4 bytes each)
-		if size < 8 {
-			err = errors.New("corrupted image")
+		header, headerErr := readISOBoxHeader(reader)
+		if headerErr == io.EOF || headerErr == io.ErrUnexpectedEOF {
+			// Truncated files still have their meta box upfront
+			return
+		}
+		if headerErr != nil {
+			err = headerErr
 			return
 		}
 
-		// Image spatial Extents (ispe) indicates the width and height of the associated image item
-		if tag == "ispe" {
-			foundIspe = true
-			// Discard junk value
-			if _, seekErr := reader.Seek(4, io.SeekCurrent); seekErr != nil {
-				err = seekErr
+		if header.Type == "meta" {
+			if meta, err = readISOBoxPayload(reader, header); err != nil {
 				return
 			}
+		} else {
+			if header.Type == "moov" && moovOffset < 0 {
+				moovOffset = offset
+			}
 
-			widthU32, widthErr := imagebytes.ReadU32(reader, imagebytes.BigEndian)
-			heightU32, heightErr := imagebytes.ReadU32(reader, imagebytes.BigEndian)
-			if sizeErr := imagerrors.Join(widthErr, heightErr); err != nil {
-				err = sizeErr
+			if header.Size < 0 {
 				return
 			}
 
-			w, h := int(widthU32), int(heightU32)
-			// Assign new largest size by area
-			if w*h > maxWidth*maxHeight {
-				maxWidth = w
-				maxHeight = h
+			if _, err = reader.Seek(header.PayloadSize(), io.SeekCurrent); err != nil {
+				return
+			}
+		}
+
+		if meta != nil && moovOffset >= 0 {
+			return
+		}
+	}
+}
+
+// Reads the moov box at the given offset and reports the display size of its picture track.
+func (e HEIF) fromSequence(reader io.ReadSeeker, moovOffset int64) (*HEIFInfo, error) {
+	if _, err := reader.Seek(moovOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	header, err := readISOBoxHeader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read moov box: %w", err)
+	}
+
+	payload, err := readISOBoxPayload(reader, header)
+	if err != nil {
+		return nil, err
+	}
+
+	sequence, err := parseHEIFSequence(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse moov box: %w", err)
+	}
+
+	return &HEIFInfo{
+		Width:        sequence.DisplayWidth,
+		Height:       sequence.DisplayHeight,
+		Sequence:     sequence,
+		FromSequence: true,
+		OrientedSize: OrientedSize{
+			DisplayWidth:  sequence.DisplayWidth,
+			DisplayHeight: sequence.DisplayHeight,
+		},
+	}, nil
+}
+
+// Resolves the primary item of the meta box payload.
+func (e HEIF) extractItems(reader io.ReadSeeker, payload []byte) (*HEIFInfo, error) {
+	meta, err := parseHEIFMeta(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := e.resolveItems(meta)
+	if err != nil {
+		if !e.FallbackToLargest {
+			return nil, err
+		}
+		if info, err = e.largestSpatialExtent(meta); err != nil {
+			return nil, err
+		}
+	}
+
+	info.OrientedSize = OrientedSize{DisplayWidth: info.Width, DisplayHeight: info.Height}
+	if buf, ok := e.readExif(reader, meta); ok {
+		exif := openEXIF(buf)
+		info.Orientation = orientedSize(exif, info.Width, info.Height).Orientation
+
+		// The display size is the size of the item, only rotated by its irot property
+		displayed := OrientedSize{Orientation: heifOrientation(info.Primary.Transformations), DisplayWidth: info.Width, DisplayHeight: info.Height}
+		info.Resolution = resolveResolution(displayed, exifResolution(exif))
+	}
+
+	if e.ReadColorProfile {
+		if info.ColorProfile, err = e.colorProfile(meta, info); err != nil {
+			return nil, err
+		}
+	}
+
+	if e.ReadXMP {
+		info.XMP = e.readXMP(reader, meta)
+	}
+
+	return info, nil
+}
+
+// Reads the colr properties of the primary item, or of the first input of a derived primary item.
+func (e HEIF) colorProfile(meta *heifMeta, info *HEIFInfo) (*ColorProfile, error) {
+	ids := []uint32{info.Primary.ID}
+	for _, item := range info.Items {
+		if item.Role == HEIFRoleTile && item.RefItemID == info.Primary.ID {
+			ids = append(ids, item.ID)
+			break
+		}
+	}
+
+	for _, id := range ids {
+		var profile *ColorProfile
+		for _, assoc := range meta.associations[id] {
+			prop, ok := meta.property(assoc)
+			if !ok || prop.boxType != "colr" {
+				continue
 			}
-		} else if tag == "irot" { // Image Rotation (irot): Rotation by 90, 180, or 270 degrees.
-			rotation, err = imagebytes.ReadU8(reader)
+
+			if profile == nil {
+				profile = new(ColorProfile)
+			}
+			if err := parseHEIFColr(prop.payload, profile); err != nil {
+				return nil, fmt.Errorf("failed to read colr of item %d: %w", id, err)
+			}
+		}
+
+		if profile != nil {
+			return profile, nil
+		}
+	}
+	return nil, nil
+}
+
+// Reads the TIFF data of the Exif item describing the primary item, or of the first Exif item
+// if none refers to it, up to the end of IFD0. Malformed Exif items are ignored, like malformed
+// EXIF data in other formats.
+func (e HEIF) readExif(reader io.ReadSeeker, meta *heifMeta) ([]byte, bool) {
+	var exifID uint32
+	found := false
+	for _, item := range meta.items {
+		if item.itemType != "Exif" {
+			continue
+		}
+
+		if !found {
+			exifID, found = item.id, true
+		}
+		if meta.describes(item.id, meta.primaryID) {
+			exifID = item.id
+			break
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	data, err := meta.readItemPrefix(reader, exifID, 4)
+	if err != nil || len(data) < 4 {
+		return nil, false
+	}
+
+	// The TIFF header follows a 32-bit offset, usually pointing past an "Exif\0\0" prefix.
+	// Only IFD0 and the resolution values are read, growing the prefix until they fit.
+	start := uint64(binary.BigEndian.Uint32(data)) + 4
+	size := start + 8
+	for {
+		if size > maxEXIFSize {
+			return nil, false
+		}
+
+		if data, err = meta.readItemPrefix(reader, exifID, int(size)); err != nil || uint64(len(data)) < start {
+			return nil, false
+		}
+
+		needed, err := tiffIFD0Size(data[start:], tiffTagXResolution, tiffTagYResolution)
+		if err != nil {
+			return nil, false
+		}
+		if start+needed <= size || uint64(len(data)) < size {
+			// Truncated items keep what they have, like truncated EXIF data in other formats
+			return data[start:], true
+		}
+		size = start + needed
+	}
+}
+
+// Reads the XMP packet of the mime item describing the primary item, or of the first XMP item
+// if none refers to it. Malformed XMP items are ignored, like malformed Exif items.
+func (e HEIF) readXMP(reader io.ReadSeeker, meta *heifMeta) *XMP {
+	var xmpID uint32
+	found := false
+	for _, item := range meta.items {
+		if item.itemType != "mime" || item.contentType != "application/rdf+xml" {
+			continue
+		}
+
+		if !found {
+			xmpID, found = item.id, true
+		}
+		if meta.describes(item.id, meta.primaryID) {
+			xmpID = item.id
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	data, err := meta.readItemData(reader, xmpID, maxXMPSize)
+	if err != nil {
+		return nil
+	}
+	return newXMP(data)
+}
+
+func (e HEIF) resolveItems(meta *heifMeta) (*HEIFInfo, error) {
+	if !meta.hasPrimary {
+		return nil, errors.New("not enough data to extract size: pitm not found")
+	}
+
+	items := make([]HEIFItem, len(meta.items))
+	indexByID := make(map[uint32]int, len(meta.items))
+	primaryHasIspe := false
+	for i, itemInfo := range meta.items {
+		item := HEIFItem{
+			ID:     itemInfo.id,
+			Type:   itemInfo.itemType,
+			Name:   itemInfo.name,
+			Hidden: itemInfo.hidden,
+		}
+
+		ispe, hasIspe := meta.itemProperty(item.ID, "ispe")
+		if hasIspe {
+			width, height, err := parseHEIFIspe(ispe.payload)
 			if err != nil {
-				return
+				return nil, fmt.Errorf("failed to read ispe of item %d: %w", item.ID, err)
+			}
+			item.Width, item.Height = width, height
+			primaryHasIspe = primaryHasIspe || item.ID == meta.primaryID
+		}
+
+		if e.DecodeCodecConfig {
+			// Undecodable configurations are left out, unless the size of the primary item depends on them
+			config, err := decodeHEIFCodecConfig(meta, item.ID)
+			if err != nil && item.ID == meta.primaryID && !hasIspe {
+				return nil, fmt.Errorf("failed to decode codec configuration of item %d: %w", item.ID, err)
+			}
+
+			if config != nil {
+				if hasIspe {
+					config.SizeMismatch = config.Width != item.Width || config.Height != item.Height
+				} else {
+					item.Width, item.Height = config.Width, config.Height
+				}
+				item.CodecConfig = config
 			}
-		} else if size >= ipcoSize { // If we've gone past the ipco boundary, then break
+		}
+
+		if err := e.applyTransformations(meta, &item); err != nil {
+			return nil, fmt.Errorf("failed to transform item %d: %w", item.ID, err)
+		}
+
+		items[i] = item
+		indexByID[item.ID] = i
+	}
+
+	for _, ref := range meta.references {
+		from, ok := indexByID[ref.from]
+		if !ok {
+			continue
+		}
+
+		switch ref.refType {
+		case "thmb":
+			items[from].Role = HEIFRoleThumbnail
+		case "cdsc":
+			items[from].Role = HEIFRoleMetadata
+		case "auxl":
+			items[from].Role = HEIFRoleAuxiliary
+			if auxC, ok := meta.itemProperty(ref.from, "auxC"); ok {
+				auxType, err := parseHEIFAuxC(auxC.payload)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read auxC of item %d: %w", ref.from, err)
+				}
+
+				items[from].AuxiliaryType = auxType
+				if _, ok := heifAlphaAuxTypes[auxType]; ok {
+					items[from].Role = HEIFRoleAlpha
+				} else if _, ok := heifDepthAuxTypes[auxType]; ok {
+					items[from].Role = HEIFRoleDepth
+				} else if auxType == heifAppleGainMapAuxType {
+					items[from].Role = HEIFRoleGainMap
+				}
+			}
+		case "dimg":
+			// The derived image references its inputs, the base image and the gain map for a tone map
+			for i, id := range ref.to {
+				if to, ok := indexByID[id]; ok && items[to].RefItemID == 0 {
+					items[to].Role = HEIFRoleTile
+					if i == 1 && items[from].Type == "tmap" {
+						items[to].Role = HEIFRoleGainMap
+					}
+					items[to].RefItemID = ref.from
+				}
+			}
+			continue
+		default:
+			continue
+		}
+
+		if len(ref.to) > 0 {
+			items[from].RefItemID = ref.to[0]
+		}
+	}
+
+	primaryIndex, ok := indexByID[meta.primaryID]
+	if !ok {
+		return nil, fmt.Errorf("primary item %d not found in iinf", meta.primaryID)
+	}
+
+	// The other items keep their iinf order
+	info := &HEIFInfo{Primary: items[primaryIndex]}
+	info.Primary.Role = HEIFRolePrimary
+	info.Items = append(items[:primaryIndex], items[primaryIndex+1:]...)
+
+	if !primaryHasIspe && info.Primary.CodecConfig == nil {
+		return nil, errors.New("not enough data to extract size: ispe of the primary item not found")
+	}
+
+	info.Width, info.Height = info.Primary.DisplayWidth, info.Primary.DisplayHeight
+
+	for _, item := range info.Items {
+		if item.Role != HEIFRoleGainMap {
+			continue
+		}
+
+		source := GainMapApple
+		if item.AuxiliaryType == "" {
+			source = GainMapISO21496
+		}
+		info.GainMap = &GainMap{Source: source, Width: item.DisplayWidth, Height: item.DisplayHeight}
+
+		// Prefer the standard gain map of files that carry both
+		if source == GainMapISO21496 {
 			break
-		} else {
-			// If we're still inside ipco, consume all bytes for the current tag
-			ipcoSize -= size
+		}
+	}
+	return info, nil
+}
 
-			if _, seekErr := reader.Seek(int64(size-8), io.SeekCurrent); seekErr != nil {
-				err = seekErr
-				return
+// Computes the display size of the item by applying its transformative properties in ipma order.
+// See ISO/IEC 23008-12, section 6.5.
+func (e HEIF) applyTransformations(meta *heifMeta, item *HEIFItem) error {
+	width, height := item.Width, item.Height
+
+	for _, assoc := range meta.associations[item.ID] {
+		prop, ok := meta.property(assoc)
+		if !ok {
+			continue
+		}
+
+		transformation := HEIFTransformation{Type: prop.boxType}
+
+		switch prop.boxType {
+		case "clap":
+			crop, err := parseHEIFClap(prop.payload, width, height)
+			if err != nil {
+				return err
+			}
+
+			transformation.Crop = crop
+			width, height = crop.Dx(), crop.Dy()
+		case "irot":
+			if len(prop.payload) < 1 {
+				return errors.New("corrupted image: irot box is too small")
+			}
+
+			transformation.Angle = int(prop.payload[0]&0x03) * 90
+			// If rotation is 90deg or 270deg, swap dims
+			if transformation.Angle%180 != 0 {
+				width, height = height, width
+			}
+		case "imir":
+			if len(prop.payload) < 1 {
+				return errors.New("corrupted image: imir box is too small")
+			}
+
+			transformation.Axis = prop.payload[0] & 0x01
+		default:
+			continue
+		}
+
+		item.Transformations = append(item.Transformations, transformation)
+	}
+
+	item.DisplayWidth, item.DisplayHeight = width, height
+	return nil
+}
+
+// Returns the orientation equivalent to the irot and imir transformations, OrientationUnknown without any.
+func heifOrientation(transformations []HEIFTransformation) Orientation {
+	// The transformations are reduced to a left-right mirror followed by a clockwise rotation
+	mirrored, rotation, found := false, 0, false
+	for _, transformation := range transformations {
+		switch transformation.Type {
+		case "irot":
+			rotation = (rotation + 360 - transformation.Angle) % 360
+		case "imir":
+			// Mirroring after a rotation is mirroring before the opposite rotation,
+			// a top-bottom mirror is a left-right mirror rotated by 180 degrees
+			mirrored, rotation = !mirrored, (360-rotation)%360
+			if transformation.Axis == 1 {
+				rotation = (rotation + 180) % 360
+			}
+		default:
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return OrientationUnknown
+	}
+
+	if mirrored {
+		return [...]Orientation{OrientationMirrorHorizontal, OrientationTransverse, OrientationMirrorVertical, OrientationTranspose}[rotation/90]
+	}
+	return [...]Orientation{OrientationNormal, OrientationRotate90, OrientationRotate180, OrientationRotate270}[rotation/90]
+}
+
+// Reports the largest ispe property by area regardless of the item it belongs to,
+// rotated by the last irot property found.
+func (e HEIF) largestSpatialExtent(meta *heifMeta) (*HEIFInfo, error) {
+	info := &HEIFInfo{Largest: true}
+	foundIspe := false
+	var rotation uint8
+
+	for _, prop := range meta.properties {
+		switch prop.boxType {
+		case "ispe":
+			w, h, err := parseHEIFIspe(prop.payload)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ispe: %w", err)
+			}
+
+			foundIspe = true
+			// Assign new largest size by area
+			if w*h > info.Width*info.Height {
+				info.Width, info.Height = w, h
+			}
+		case "irot":
+			if len(prop.payload) > 0 {
+				rotation = prop.payload[0] & 0x03
 			}
 		}
 	}
 
 	if !foundIspe {
-		err = errors.New("not enough data to extract size: ispe not found")
-		return
+		return nil, errors.New("not enough data to extract size: ispe not found")
 	}
 
+	info.Primary.Width, info.Primary.Height = info.Width, info.Height
+	info.Primary.DisplayWidth, info.Primary.DisplayHeight = info.Width, info.Height
+
 	// If rotation is 90deg (1) or 270deg (3), swap dims
 	if rotation == 1 || rotation == 3 {
-		maxWidth, maxHeight = maxHeight, maxWidth
+		info.Width, info.Height = info.Height, info.Width
+		info.Primary.DisplayWidth, info.Primary.DisplayHeight = info.Width, info.Height
 	}
 
-	width = maxWidth
-	height = maxHeight
-
-	return
+	return info, nil
 }
 
 func (e HEIF) BufSize() int {
@@ -219,36 +877,11 @@ func (e HEIF) matchBrandFormat(brand [4]byte) (format string, match bool) {
 		format = "heic"
 	case av1BrandKey:
 		format = "avif"
-	case jpegBrandKey:
-		format = "jpeg"
+	case jpegBrandKey, j2kBrandKey:
+		// Neither HEVC nor AV1 coded, report the generic container rather than the codec,
+		// which is available from HEIFInfo.Codec
+		format = "heif"
 	}
 
 	return
 }
-
-func (e HEIF) skipToTag(reader io.ReadSeeker, tag []byte) (uint32, error) {
-	var tagBuf [4]byte
-
-	for {
-		size, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
-		if err != nil {
-			return 0, err
-		}
-
-		if _, err := io.ReadFull(reader, tagBuf[:]); err != nil {
-			return 0, err
-		}
-
-		if bytes.Equal(tagBuf[:], tag) {
-			return size, nil
-		}
-
-		if size >= 8 {
-			if _, err := reader.Seek(int64(size)-8, io.SeekCurrent); err != nil {
-				return 0, err
-			}
-		} else {
-			return 0, errors.New("invalid HEIF box size")
-		}
-	}
-}
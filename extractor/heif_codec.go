@@ -0,0 +1,543 @@
+package extractor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pillowskiy/imagesize/imagebytes"
+)
+
+// HEIFCodecConfig describes the coded image as decoded from the codec configuration
+// of an item (HEVC SPS from hvcC or AV1 sequence header from av1C).
+type HEIFCodecConfig struct {
+	// Coded size, after conformance window cropping for HEVC.
+	Width  int
+	Height int
+
+	// Bit depth of the luma and chroma samples.
+	BitDepth       int
+	ChromaBitDepth int
+
+	// Chroma subsampling ("4:0:0", "4:2:0", "4:2:2" or "4:4:4").
+	ChromaSubsampling string
+
+	// SizeMismatch reports that the coded size disagrees with the ispe property of the item.
+	SizeMismatch bool
+}
+
+const hevcNALUnitSPS = 33
+
+var chromaSubsamplings = [...]string{"4:0:0", "4:2:0", "4:2:2", "4:4:4"}
+
+// Decodes the codec configuration property associated with the item, nil if there is none
+// or if it does not carry the size of the item.
+func decodeHEIFCodecConfig(meta *heifMeta, id uint32) (*HEIFCodecConfig, error) {
+	for _, assoc := range meta.associations[id] {
+		prop, ok := meta.property(assoc)
+		if !ok {
+			continue
+		}
+
+		switch prop.boxType {
+		case "hvcC":
+			return parseHEVCConfig(prop.payload)
+		case "av1C":
+			return parseAV1Config(prop.payload)
+		}
+	}
+	return nil, nil
+}
+
+// Parses the HEVC Decoder Configuration Record and decodes the first SPS NAL unit, nil if there is none.
+// See ISO/IEC 14496-15, section 8.3.3.1.
+func parseHEVCConfig(payload []byte) (*HEIFCodecConfig, error) {
+	// Fixed part of the record, the last byte is the number of NAL unit arrays
+	const headerSize = 23
+	if len(payload) < headerSize {
+		return nil, errors.New("corrupted image: hvcC box is too small")
+	}
+
+	arrays := int(payload[headerSize-1])
+	buf := payload[headerSize:]
+
+	for i := 0; i < arrays; i++ {
+		if len(buf) < 3 {
+			return nil, errors.New("corrupted image: hvcC box is too small")
+		}
+
+		nalType := buf[0] & 0x3F
+		count := int(buf[1])<<8 | int(buf[2])
+		buf = buf[3:]
+
+		for j := 0; j < count; j++ {
+			if len(buf) < 2 {
+				return nil, errors.New("corrupted image: hvcC box is too small")
+			}
+
+			size := int(buf[0])<<8 | int(buf[1])
+			if len(buf) < 2+size {
+				return nil, errors.New("corrupted image: hvcC NAL unit is too small")
+			}
+
+			if nalType == hevcNALUnitSPS {
+				config, err := parseHEVCSPS(buf[2 : 2+size])
+				if err != nil {
+					return nil, fmt.Errorf("failed to decode HEVC SPS: %w", err)
+				}
+				return config, nil
+			}
+
+			buf = buf[2+size:]
+		}
+	}
+
+	// Without parameter sets in the record, they are only found in the item data
+	return nil, nil
+}
+
+// Decodes a Sequence Parameter Set NAL unit up to the bit depths.
+// See ITU-T H.265, section 7.3.2.2.
+func parseHEVCSPS(nal []byte) (*HEIFCodecConfig, error) {
+	// Skip the 2 byte NAL unit header
+	if len(nal) < 2 {
+		return nil, errors.New("NAL unit is too small")
+	}
+	reader := imagebytes.NewBitReader(unescapeRBSP(nal[2:]))
+
+	// sps_video_parameter_set_id (4)
+	if err := reader.Skip(4); err != nil {
+		return nil, err
+	}
+
+	maxSubLayersMinus1, err := reader.ReadBits(3)
+	if err != nil {
+		return nil, err
+	}
+
+	// sps_temporal_id_nesting_flag (1)
+	if err := reader.Skip(1); err != nil {
+		return nil, err
+	}
+
+	if err := skipHEVCProfileTierLevel(reader, int(maxSubLayersMinus1)); err != nil {
+		return nil, err
+	}
+
+	// sps_seq_parameter_set_id
+	if _, err := reader.ReadUE(); err != nil {
+		return nil, err
+	}
+
+	chromaFormat, err := reader.ReadUE()
+	if err != nil {
+		return nil, err
+	}
+	if chromaFormat > 3 {
+		return nil, fmt.Errorf("invalid chroma_format_idc %d", chromaFormat)
+	}
+
+	separateColourPlanes := false
+	if chromaFormat == 3 {
+		if separateColourPlanes, err = reader.ReadFlag(); err != nil {
+			return nil, err
+		}
+	}
+
+	var values [2]uint64 // pic_width_in_luma_samples, pic_height_in_luma_samples
+	for i := range values {
+		if values[i], err = reader.ReadUE(); err != nil {
+			return nil, err
+		}
+	}
+	width, height := int64(values[0]), int64(values[1])
+
+	conformanceWindow, err := reader.ReadFlag()
+	if err != nil {
+		return nil, err
+	}
+
+	if conformanceWindow {
+		var offsets [4]uint64 // left, right, top, bottom
+		for i := range offsets {
+			if offsets[i], err = reader.ReadUE(); err != nil {
+				return nil, err
+			}
+		}
+
+		// Offsets are expressed in chroma samples
+		subWidth, subHeight := int64(1), int64(1)
+		if !separateColourPlanes && (chromaFormat == 1 || chromaFormat == 2) {
+			subWidth = 2
+		}
+		if !separateColourPlanes && chromaFormat == 1 {
+			subHeight = 2
+		}
+
+		width -= subWidth * int64(offsets[0]+offsets[1])
+		height -= subHeight * int64(offsets[2]+offsets[3])
+		if width <= 0 || height <= 0 {
+			return nil, errors.New("conformance window exceeds the picture size")
+		}
+	}
+
+	var bitDepths [2]uint64 // bit_depth_luma_minus8, bit_depth_chroma_minus8
+	for i := range bitDepths {
+		if bitDepths[i], err = reader.ReadUE(); err != nil {
+			return nil, err
+		}
+	}
+
+	// ChromaArrayType is 0 (monochrome) when colour planes are coded separately
+	if separateColourPlanes {
+		chromaFormat = 0
+	}
+
+	return &HEIFCodecConfig{
+		Width:             int(width),
+		Height:            int(height),
+		BitDepth:          int(bitDepths[0]) + 8,
+		ChromaBitDepth:    int(bitDepths[1]) + 8,
+		ChromaSubsampling: chromaSubsamplings[chromaFormat],
+	}, nil
+}
+
+// Skips profile_tier_level(1, maxNumSubLayersMinus1).
+// See ITU-T H.265, section 7.3.3.
+func skipHEVCProfileTierLevel(reader *imagebytes.BitReader, maxSubLayersMinus1 int) error {
+	// General profile (88 bits) and general_level_idc (8 bits)
+	if err := reader.Skip(88 + 8); err != nil {
+		return err
+	}
+
+	profilePresent := make([]bool, maxSubLayersMinus1)
+	levelPresent := make([]bool, maxSubLayersMinus1)
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		var err error
+		if profilePresent[i], err = reader.ReadFlag(); err != nil {
+			return err
+		}
+		if levelPresent[i], err = reader.ReadFlag(); err != nil {
+			return err
+		}
+	}
+
+	// Alignment to 8 sub-layer entries with reserved_zero_2bits
+	if maxSubLayersMinus1 > 0 {
+		if err := reader.Skip(2 * (8 - maxSubLayersMinus1)); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < maxSubLayersMinus1; i++ {
+		if profilePresent[i] {
+			if err := reader.Skip(88); err != nil {
+				return err
+			}
+		}
+		if levelPresent[i] {
+			if err := reader.Skip(8); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Removes emulation prevention bytes (0x03 following 0x0000) from a NAL unit payload.
+func unescapeRBSP(buf []byte) []byte {
+	rbsp := make([]byte, 0, len(buf))
+	zeros := 0
+	for _, b := range buf {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, b)
+	}
+	return rbsp
+}
+
+// AV1 OBU type of the sequence header.
+const av1OBUSequenceHeader = 1
+
+// Parses the AV1 Codec Configuration Record, taking the bit depth and subsampling from the record
+// and the maximum frame size from the sequence header OBU. Returns nil without a sequence header.
+// See https://aomediacodec.github.io/av1-isobmff/#av1codecconfigurationbox-section
+func parseAV1Config(payload []byte) (*HEIFCodecConfig, error) {
+	if len(payload) < 4 {
+		return nil, errors.New("corrupted image: av1C box is too small")
+	}
+
+	profile := payload[1] >> 5
+	highBitDepth := payload[2]&0x40 != 0
+	twelveBit := payload[2]&0x20 != 0
+	monochrome := payload[2]&0x10 != 0
+	subsamplingX := payload[2]&0x08 != 0
+	subsamplingY := payload[2]&0x04 != 0
+
+	config := &HEIFCodecConfig{BitDepth: 8}
+	if highBitDepth {
+		config.BitDepth = 10
+		if profile == 2 && twelveBit {
+			config.BitDepth = 12
+		}
+	}
+	config.ChromaBitDepth = config.BitDepth
+
+	switch {
+	case monochrome:
+		config.ChromaSubsampling = chromaSubsamplings[0]
+	case subsamplingX && subsamplingY:
+		config.ChromaSubsampling = chromaSubsamplings[1]
+	case subsamplingX:
+		config.ChromaSubsampling = chromaSubsamplings[2]
+	default:
+		config.ChromaSubsampling = chromaSubsamplings[3]
+	}
+
+	obus := payload[4:]
+	for len(obus) > 0 {
+		obuType, obu, rest, err := readAV1OBU(obus)
+		if err != nil {
+			return nil, err
+		}
+
+		if obuType == av1OBUSequenceHeader {
+			width, height, err := parseAV1SequenceHeader(obu)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode AV1 sequence header: %w", err)
+			}
+
+			config.Width, config.Height = width, height
+			return config, nil
+		}
+		obus = rest
+	}
+
+	// configOBUs are optional, the sequence header is then only found in the item data
+	return nil, nil
+}
+
+// Splits the first OBU off buf, returning its type and payload.
+// See AV1 specification, section 5.3.
+func readAV1OBU(buf []byte) (obuType uint8, payload, rest []byte, err error) {
+	header := buf[0]
+	obuType = header >> 3 & 0x0F
+	hasExtension := header&0x04 != 0
+	hasSize := header&0x02 != 0
+
+	offset := 1
+	if hasExtension {
+		offset++
+	}
+	if offset > len(buf) {
+		err = errors.New("corrupted image: OBU header is truncated")
+		return
+	}
+
+	size := uint64(len(buf) - offset)
+	if hasSize {
+		// leb128 encoded size
+		size = 0
+		for i := 0; ; i++ {
+			if offset >= len(buf) || i == 8 {
+				err = errors.New("corrupted image: OBU size is truncated")
+				return
+			}
+
+			b := buf[offset]
+			offset++
+			size |= uint64(b&0x7F) << (7 * uint(i))
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	if size > uint64(len(buf)-offset) {
+		err = errors.New("corrupted image: OBU is truncated")
+		return
+	}
+
+	end := offset + int(size)
+	return obuType, buf[offset:end], buf[end:], nil
+}
+
+// Decodes a sequence header OBU up to max_frame_width_minus_1 and max_frame_height_minus_1.
+// See AV1 specification, section 5.5.
+func parseAV1SequenceHeader(obu []byte) (width, height int, err error) {
+	reader := imagebytes.NewBitReader(obu)
+
+	// seq_profile (3), still_picture (1)
+	if err = reader.Skip(4); err != nil {
+		return
+	}
+
+	reducedStillPictureHeader, err := reader.ReadFlag()
+	if err != nil {
+		return
+	}
+
+	if reducedStillPictureHeader {
+		// seq_level_idx[0]
+		if err = reader.Skip(5); err != nil {
+			return
+		}
+	} else if err = skipAV1OperatingPoints(reader); err != nil {
+		return
+	}
+
+	widthBits, err := reader.ReadBits(4)
+	if err != nil {
+		return
+	}
+
+	heightBits, err := reader.ReadBits(4)
+	if err != nil {
+		return
+	}
+
+	widthMinus1, err := reader.ReadBits(int(widthBits) + 1)
+	if err != nil {
+		return
+	}
+
+	heightMinus1, err := reader.ReadBits(int(heightBits) + 1)
+	if err != nil {
+		return
+	}
+
+	return int(widthMinus1) + 1, int(heightMinus1) + 1, nil
+}
+
+// Skips timing info, decoder model info and the operating points of a full sequence header.
+func skipAV1OperatingPoints(reader *imagebytes.BitReader) error {
+	timingInfoPresent, err := reader.ReadFlag()
+	if err != nil {
+		return err
+	}
+
+	decoderModelInfoPresent := false
+	var bufferDelayLength int
+	if timingInfoPresent {
+		// num_units_in_display_tick (32), time_scale (32)
+		if err := reader.Skip(64); err != nil {
+			return err
+		}
+
+		equalPictureInterval, err := reader.ReadFlag()
+		if err != nil {
+			return err
+		}
+		if equalPictureInterval {
+			if err := skipAV1UVLC(reader); err != nil {
+				return err
+			}
+		}
+
+		if decoderModelInfoPresent, err = reader.ReadFlag(); err != nil {
+			return err
+		}
+
+		if decoderModelInfoPresent {
+			bufferDelayLengthMinus1, err := reader.ReadBits(5)
+			if err != nil {
+				return err
+			}
+			bufferDelayLength = int(bufferDelayLengthMinus1) + 1
+
+			// num_units_in_decoding_tick (32), buffer_removal_time_length_minus_1 (5),
+			// frame_presentation_time_length_minus_1 (5)
+			if err := reader.Skip(32 + 5 + 5); err != nil {
+				return err
+			}
+		}
+	}
+
+	initialDisplayDelayPresent, err := reader.ReadFlag()
+	if err != nil {
+		return err
+	}
+
+	operatingPointsMinus1, err := reader.ReadBits(5)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i <= int(operatingPointsMinus1); i++ {
+		// operating_point_idc (12)
+		if err := reader.Skip(12); err != nil {
+			return err
+		}
+
+		level, err := reader.ReadBits(5)
+		if err != nil {
+			return err
+		}
+
+		// seq_tier
+		if level > 7 {
+			if err := reader.Skip(1); err != nil {
+				return err
+			}
+		}
+
+		if decoderModelInfoPresent {
+			present, err := reader.ReadFlag()
+			if err != nil {
+				return err
+			}
+
+			// decoder_buffer_delay, encoder_buffer_delay, low_delay_mode_flag
+			if present {
+				if err := reader.Skip(2*bufferDelayLength + 1); err != nil {
+					return err
+				}
+			}
+		}
+
+		if initialDisplayDelayPresent {
+			present, err := reader.ReadFlag()
+			if err != nil {
+				return err
+			}
+
+			// initial_display_delay_minus_1
+			if present {
+				if err := reader.Skip(4); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Skips a uvlc() code, the AV1 variant of unsigned Exp-Golomb codes.
+func skipAV1UVLC(reader *imagebytes.BitReader) error {
+	leadingZeros := 0
+	for {
+		done, err := reader.ReadFlag()
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+		leadingZeros++
+	}
+
+	// Values of 32 or more leading zeros are clamped by the specification and carry no bits
+	if leadingZeros >= 32 {
+		return nil
+	}
+	return reader.Skip(leadingZeros)
+}
@@ -0,0 +1,592 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/pillowskiy/imagesize/imagebytes"
+	"github.com/pillowskiy/imagesize/imagerrors"
+)
+
+// heifMeta holds the item structure parsed from a HEIF meta box.
+// See ISO/IEC 23008-12 (HEIF) and ISO/IEC 14496-12 (ISOBMFF), section 8.11.
+type heifMeta struct {
+	primaryID  uint32
+	hasPrimary bool
+
+	items      []heifItemInfo
+	references []heifReference
+
+	// Item properties in ipco order, property index N refers to properties[N-1].
+	properties   []heifProperty
+	associations map[uint32][]heifAssociation
+
+	locations map[uint32]heifItemLocation
+	idat      []byte
+}
+
+type heifItemInfo struct {
+	id       uint32
+	itemType string
+	name     string
+	hidden   bool
+
+	// Content type of mime items, e.g. "application/rdf+xml" for XMP.
+	contentType string
+}
+
+type heifReference struct {
+	refType string
+	from    uint32
+	to      []uint32
+}
+
+type heifProperty struct {
+	boxType string
+	payload []byte
+}
+
+type heifAssociation struct {
+	index     uint16
+	essential bool
+}
+
+// Construction methods of item locations.
+const (
+	heifFileOffset = 0
+	heifIdatOffset = 1
+)
+
+type heifItemLocation struct {
+	method     uint8
+	baseOffset uint64
+	extents    []heifExtent
+}
+
+type heifExtent struct {
+	offset uint64
+	length uint64
+}
+
+// Parses the payload of a meta box.
+func parseHEIFMeta(payload []byte) (*heifMeta, error) {
+	// meta is a full box, skip version and flags
+	if len(payload) < 4 {
+		return nil, errors.New("corrupted image: meta box is too small")
+	}
+
+	meta := &heifMeta{
+		associations: make(map[uint32][]heifAssociation),
+		locations:    make(map[uint32]heifItemLocation),
+	}
+	err := walkISOBoxes(payload[4:], func(boxType string, box []byte) error {
+		switch boxType {
+		case "pitm":
+			return meta.parsePitm(box)
+		case "iinf":
+			return meta.parseIinf(box)
+		case "iref":
+			return meta.parseIref(box)
+		case "iprp":
+			return meta.parseIprp(box)
+		case "iloc":
+			return meta.parseIloc(box)
+		case "idat":
+			meta.idat = box
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse meta box: %w", err)
+	}
+
+	return meta, nil
+}
+
+// Primary Item (pitm) holds the ID of the item that should be displayed by default.
+func (m *heifMeta) parsePitm(box []byte) error {
+	reader := bytes.NewReader(box)
+	version, _, err := readFullBoxHeader(reader)
+	if err != nil {
+		return err
+	}
+
+	if m.primaryID, err = readItemID(reader, version); err != nil {
+		return err
+	}
+	m.hasPrimary = true
+	return nil
+}
+
+// Item Information (iinf) contains an Item Info Entry (infe) box per item.
+func (m *heifMeta) parseIinf(box []byte) error {
+	reader := bytes.NewReader(box)
+	version, _, err := readFullBoxHeader(reader)
+	if err != nil {
+		return err
+	}
+
+	// Entry count has the same width as item IDs
+	if _, err := readItemID(reader, version); err != nil {
+		return err
+	}
+
+	return walkISOBoxes(box[len(box)-reader.Len():], func(boxType string, entry []byte) error {
+		if boxType != "infe" {
+			return nil
+		}
+
+		item, err := parseHEIFItemInfo(entry)
+		if err != nil {
+			return fmt.Errorf("failed to parse infe box: %w", err)
+		}
+		if item != nil {
+			m.items = append(m.items, *item)
+		}
+		return nil
+	})
+}
+
+// Parses an Item Info Entry, only versions 2 and 3 describe image items.
+func parseHEIFItemInfo(box []byte) (*heifItemInfo, error) {
+	reader := bytes.NewReader(box)
+	version, flags, err := readFullBoxHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if version < 2 {
+		return nil, nil
+	}
+
+	item := &heifItemInfo{hidden: flags&1 != 0}
+	if item.id, err = readItemID(reader, version-2); err != nil {
+		return nil, err
+	}
+
+	// Skip item_protection_index
+	if _, err := imagebytes.ReadU16(reader, imagebytes.BigEndian); err != nil {
+		return nil, err
+	}
+
+	var itemType [4]byte
+	if _, err := io.ReadFull(reader, itemType[:]); err != nil {
+		return nil, err
+	}
+	item.itemType = string(itemType[:])
+
+	// Item name is optional in practice, ignore truncated names
+	item.name, _ = readCString(reader)
+
+	if item.itemType == "mime" {
+		item.contentType, _ = readCString(reader)
+	}
+	return item, nil
+}
+
+// Item Location (iloc) tells where the data of each item is stored, as a list of extents
+// relative to the file, the idat box or another item.
+func (m *heifMeta) parseIloc(box []byte) error {
+	reader := bytes.NewReader(box)
+	version, _, err := readFullBoxHeader(reader)
+	if err != nil {
+		return err
+	}
+
+	sizes, err := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+	if err != nil {
+		return err
+	}
+
+	// Field sizes in bytes: offset (4), length (4), base_offset (4), index (4, version 1 and 2 only)
+	offsetSize, lengthSize, baseOffsetSize := int(sizes>>12), int(sizes>>8&0x0F), int(sizes>>4&0x0F)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(sizes & 0x0F)
+	}
+
+	var itemCount uint32
+	if version < 2 {
+		count, err := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+		if err != nil {
+			return err
+		}
+		itemCount = uint32(count)
+	} else if itemCount, err = imagebytes.ReadU32(reader, imagebytes.BigEndian); err != nil {
+		return err
+	}
+
+	for i := uint32(0); i < itemCount; i++ {
+		var id uint32
+		if version < 2 {
+			id, err = readItemID(reader, 0)
+		} else {
+			id, err = readItemID(reader, 1)
+		}
+		if err != nil {
+			return err
+		}
+
+		var location heifItemLocation
+		if version == 1 || version == 2 {
+			method, err := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+			if err != nil {
+				return err
+			}
+			location.method = uint8(method & 0x0F)
+		}
+
+		// Skip data_reference_index
+		if _, err := imagebytes.ReadU16(reader, imagebytes.BigEndian); err != nil {
+			return err
+		}
+
+		if location.baseOffset, err = readSizedUint(reader, baseOffsetSize); err != nil {
+			return err
+		}
+
+		extentCount, err := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+		if err != nil {
+			return err
+		}
+
+		location.extents = make([]heifExtent, 0, extentCount)
+		for j := 0; j < int(extentCount); j++ {
+			if _, err := readSizedUint(reader, indexSize); err != nil {
+				return err
+			}
+
+			var extent heifExtent
+			if extent.offset, err = readSizedUint(reader, offsetSize); err != nil {
+				return err
+			}
+			if extent.length, err = readSizedUint(reader, lengthSize); err != nil {
+				return err
+			}
+			location.extents = append(location.extents, extent)
+		}
+
+		m.locations[id] = location
+	}
+
+	return nil
+}
+
+// Reports whether the item has a cdsc reference to the described item.
+func (m *heifMeta) describes(id, describedID uint32) bool {
+	for _, ref := range m.references {
+		if ref.refType != "cdsc" || ref.from != id {
+			continue
+		}
+		for _, to := range ref.to {
+			if to == describedID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reads a big-endian unsigned integer of 0, 4 or 8 bytes.
+func readSizedUint(reader io.Reader, size int) (uint64, error) {
+	switch size {
+	case 0:
+		return 0, nil
+	case 4:
+		value, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+		return uint64(value), err
+	case 8:
+		return imagebytes.ReadU64(reader, imagebytes.BigEndian)
+	default:
+		return 0, fmt.Errorf("unsupported field size %d", size)
+	}
+}
+
+// Reads the data of an item, which may be spread over several extents in the file or the idat box.
+func (m *heifMeta) readItemData(reader io.ReadSeeker, id uint32, limit int) ([]byte, error) {
+	return m.readItem(reader, id, limit, false)
+}
+
+// Reads the first n bytes of the data of an item, less if the item is smaller.
+func (m *heifMeta) readItemPrefix(reader io.ReadSeeker, id uint32, n int) ([]byte, error) {
+	return m.readItem(reader, id, n, true)
+}
+
+// Reads the data of an item up to limit bytes, failing for larger items unless truncate is set.
+func (m *heifMeta) readItem(reader io.ReadSeeker, id uint32, limit int, truncate bool) ([]byte, error) {
+	location, ok := m.locations[id]
+	if !ok {
+		return nil, fmt.Errorf("location of item %d not found", id)
+	}
+
+	var data []byte
+	for _, extent := range location.extents {
+		if len(data) == limit && truncate {
+			break
+		}
+		offset := location.baseOffset + extent.offset
+
+		// A zero length extent spans the rest of the source, which is only bounded for idat
+		if extent.length == 0 && location.method != heifIdatOffset {
+			return nil, fmt.Errorf("unbounded extent of item %d", id)
+		}
+		if location.method == heifIdatOffset && extent.length == 0 && offset <= uint64(len(m.idat)) {
+			extent.length = uint64(len(m.idat)) - offset
+		}
+		// Compared to the remaining room, as the sum could overflow for lengths close to 2^64
+		if extent.length > uint64(limit-len(data)) {
+			if !truncate {
+				return nil, fmt.Errorf("data of item %d is too large", id)
+			}
+			extent.length = uint64(limit - len(data))
+		}
+
+		switch location.method {
+		case heifFileOffset:
+			if _, err := reader.Seek(int64(offset), io.SeekStart); err != nil {
+				return nil, err
+			}
+
+			chunk := make([]byte, extent.length)
+			if _, err := io.ReadFull(reader, chunk); err != nil {
+				return nil, fmt.Errorf("failed to read data of item %d: %w", id, err)
+			}
+			data = append(data, chunk...)
+		case heifIdatOffset:
+			end := offset + extent.length
+			if offset > end || end > uint64(len(m.idat)) {
+				return nil, fmt.Errorf("data of item %d is out of idat bounds", id)
+			}
+			data = append(data, m.idat[offset:end]...)
+		default:
+			return nil, fmt.Errorf("unsupported construction method %d of item %d", location.method, id)
+		}
+	}
+
+	return data, nil
+}
+
+// Item Reference (iref) contains a box per reference, its type is the reference type.
+func (m *heifMeta) parseIref(box []byte) error {
+	reader := bytes.NewReader(box)
+	version, _, err := readFullBoxHeader(reader)
+	if err != nil {
+		return err
+	}
+
+	return walkISOBoxes(box[4:], func(refType string, payload []byte) error {
+		refReader := bytes.NewReader(payload)
+
+		from, err := readItemID(refReader, version)
+		if err != nil {
+			return err
+		}
+
+		count, err := imagebytes.ReadU16(refReader, imagebytes.BigEndian)
+		if err != nil {
+			return err
+		}
+
+		ref := heifReference{refType: refType, from: from, to: make([]uint32, 0, count)}
+		for i := 0; i < int(count); i++ {
+			id, err := readItemID(refReader, version)
+			if err != nil {
+				return err
+			}
+			ref.to = append(ref.to, id)
+		}
+
+		m.references = append(m.references, ref)
+		return nil
+	})
+}
+
+// Item Properties (iprp) contains the Item Property Container (ipco) and
+// one or more Item Property Association (ipma) boxes.
+func (m *heifMeta) parseIprp(box []byte) error {
+	return walkISOBoxes(box, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "ipco":
+			return walkISOBoxes(payload, func(propType string, prop []byte) error {
+				m.properties = append(m.properties, heifProperty{boxType: propType, payload: prop})
+				return nil
+			})
+		case "ipma":
+			return m.parseIpma(payload)
+		}
+		return nil
+	})
+}
+
+func (m *heifMeta) parseIpma(box []byte) error {
+	reader := bytes.NewReader(box)
+	version, flags, err := readFullBoxHeader(reader)
+	if err != nil {
+		return err
+	}
+
+	entryCount, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+	if err != nil {
+		return err
+	}
+
+	for i := uint32(0); i < entryCount; i++ {
+		id, err := readItemID(reader, version)
+		if err != nil {
+			return err
+		}
+
+		count, err := imagebytes.ReadU8(reader)
+		if err != nil {
+			return err
+		}
+
+		for j := 0; j < int(count); j++ {
+			var assoc heifAssociation
+
+			// The highest bit is the essential flag, the rest is a 1-based property index
+			if flags&1 != 0 {
+				value, err := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+				if err != nil {
+					return err
+				}
+				assoc.essential = value&0x8000 != 0
+				assoc.index = value & 0x7FFF
+			} else {
+				value, err := imagebytes.ReadU8(reader)
+				if err != nil {
+					return err
+				}
+				assoc.essential = value&0x80 != 0
+				assoc.index = uint16(value & 0x7F)
+			}
+
+			m.associations[id] = append(m.associations[id], assoc)
+		}
+	}
+
+	return nil
+}
+
+// Returns the property an association refers to.
+func (m *heifMeta) property(assoc heifAssociation) (heifProperty, bool) {
+	// Index 0 means that no property is associated
+	if assoc.index == 0 || int(assoc.index) > len(m.properties) {
+		return heifProperty{}, false
+	}
+	return m.properties[assoc.index-1], true
+}
+
+// Returns the first property of the given type associated with the item.
+func (m *heifMeta) itemProperty(id uint32, boxType string) (heifProperty, bool) {
+	for _, assoc := range m.associations[id] {
+		if prop, ok := m.property(assoc); ok && prop.boxType == boxType {
+			return prop, true
+		}
+	}
+	return heifProperty{}, false
+}
+
+// Image Spatial Extents (ispe) indicates the width and height of the associated image item.
+func parseHEIFIspe(payload []byte) (width, height int, err error) {
+	// Version and flags, then the width and height (4 bytes each)
+	if len(payload) < 12 {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+
+	return int(binary.BigEndian.Uint32(payload[4:8])), int(binary.BigEndian.Uint32(payload[8:12])), nil
+}
+
+// Auxiliary Type (auxC) holds the URN describing the kind of an auxiliary image.
+func parseHEIFAuxC(payload []byte) (string, error) {
+	reader := bytes.NewReader(payload)
+	if _, _, err := readFullBoxHeader(reader); err != nil {
+		return "", err
+	}
+
+	auxType, err := readCString(reader)
+	if err == io.EOF {
+		err = nil
+	}
+	return auxType, err
+}
+
+// Colour Information (colr) holds either an ICC profile ("prof" or "rICC") or code points ("nclx"),
+// which are added to the given profile.
+func parseHEIFColr(payload []byte, profile *ColorProfile) error {
+	if len(payload) < 4 {
+		return errors.New("colr box is truncated")
+	}
+
+	switch colorType := string(payload[:4]); colorType {
+	case "prof", "rICC":
+		if len(payload)-4 > maxICCSize {
+			return errors.New("ICC profile is too large")
+		}
+
+		parsed := newICCColorProfile(payload[4:])
+		profile.ICC, profile.Description, profile.ColorSpace = parsed.ICC, parsed.Description, parsed.ColorSpace
+		profile.Primaries = parsed.Primaries
+	case "nclx":
+		// Colour primaries, transfer characteristics and matrix coefficients (2 each), full range flag (1 bit)
+		if len(payload) < 11 {
+			return errors.New("nclx colour information is truncated")
+		}
+
+		profile.CICP = &CICP{
+			ColorPrimaries:          binary.BigEndian.Uint16(payload[4:6]),
+			TransferCharacteristics: binary.BigEndian.Uint16(payload[6:8]),
+			MatrixCoefficients:      binary.BigEndian.Uint16(payload[8:10]),
+			FullRange:               payload[10]&0x80 != 0,
+		}
+	}
+	return nil
+}
+
+// Clean Aperture (clap) crops the image to a rectangle centered around the given offsets,
+// all values are stored as fractions (numerator, denominator).
+func parseHEIFClap(payload []byte, width, height int) (crop image.Rectangle, err error) {
+	reader := bytes.NewReader(payload)
+
+	var fractions [4]float64
+	for i := range fractions {
+		numerator, numErr := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+		denominator, denErr := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+		if err = imagerrors.Join(numErr, denErr); err != nil {
+			return
+		}
+
+		if denominator == 0 {
+			err = errors.New("corrupted image: clap denominator is zero")
+			return
+		}
+
+		// Width and height are unsigned, offsets are signed
+		if i < 2 {
+			fractions[i] = float64(numerator) / float64(denominator)
+		} else {
+			fractions[i] = float64(int32(numerator)) / float64(int32(denominator))
+		}
+	}
+
+	cropWidth, cropHeight := int(fractions[0]), int(fractions[1])
+	if cropWidth <= 0 || cropHeight <= 0 || cropWidth > width || cropHeight > height {
+		err = fmt.Errorf("corrupted image: clean aperture %dx%d does not fit %dx%d", cropWidth, cropHeight, width, height)
+		return
+	}
+
+	// Offsets move the center of the clean aperture relative to the center of the image
+	left := int(math.Round(float64(width-1)/2 + fractions[2] - float64(cropWidth-1)/2))
+	top := int(math.Round(float64(height-1)/2 + fractions[3] - float64(cropHeight-1)/2))
+	if left < 0 || top < 0 || left+cropWidth > width || top+cropHeight > height {
+		err = errors.New("corrupted image: clean aperture is out of bounds")
+		return
+	}
+
+	return image.Rect(left, top, left+cropWidth, top+cropHeight), nil
+}
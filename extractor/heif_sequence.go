@@ -0,0 +1,379 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/pillowskiy/imagesize/imagebytes"
+)
+
+// HEIFSequence describes the picture track of a HEIF image sequence or an animated AVIF.
+type HEIFSequence struct {
+	Animation
+
+	TrackID uint32
+
+	// Handler type of the track, "pict" for image sequences or "vide" for video tracks.
+	Handler string
+
+	// Four character code of the sample entry ("hvc1", "av01", ...).
+	Codec string
+
+	// Coded size from the sample entry.
+	Width  int
+	Height int
+
+	// Presentation size from the track header.
+	DisplayWidth  int
+	DisplayHeight int
+}
+
+// Values of the duration fields that mark an indefinite duration.
+const (
+	indefiniteDurationV0 = 0xFFFFFFFF
+	indefiniteDurationV1 = 0xFFFFFFFFFFFFFFFF
+)
+
+// heifTrack holds the boxes of a trak that are needed to describe the sequence.
+type heifTrack struct {
+	sequence HEIFSequence
+
+	// Track duration and edit list duration in movie timescale units.
+	duration     uint64
+	indefinite   bool
+	editDuration uint64
+	repeat       bool
+
+	// Media duration in media timescale units.
+	mediaTimescale uint32
+	mediaDuration  uint64
+
+	hasSampleEntry     bool
+	hasTrackDimensions bool
+}
+
+// Parses the payload of a moov box and describes its first picture track,
+// preferring "pict" handlers over "vide" ones.
+// See ISO/IEC 23008-12, section 7 and https://aomediacodec.github.io/av1-avif/#image-sequences
+func parseHEIFSequence(payload []byte) (*HEIFSequence, error) {
+	var picture, video *heifTrack
+
+	err := walkISOBoxes(payload, func(boxType string, box []byte) error {
+		if boxType != "trak" {
+			return nil
+		}
+
+		track, err := parseHEIFTrack(box)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case track.sequence.Handler == "pict" && picture == nil:
+			picture = track
+		case track.sequence.Handler == "vide" && video == nil:
+			video = track
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	track := picture
+	if track == nil {
+		track = video
+	}
+	if track == nil {
+		return nil, errors.New("not enough data to extract size: picture track not found")
+	}
+
+	if !track.hasSampleEntry && !track.hasTrackDimensions {
+		return nil, errors.New("not enough data to extract size: track dimensions not found")
+	}
+
+	sequence := track.sequence
+	sequence.Duration = timescaleDuration(track.mediaDuration, track.mediaTimescale)
+
+	// Fill in the missing sizes from each other
+	if !track.hasSampleEntry {
+		sequence.Width, sequence.Height = sequence.DisplayWidth, sequence.DisplayHeight
+	}
+	if !track.hasTrackDimensions || sequence.DisplayWidth == 0 || sequence.DisplayHeight == 0 {
+		sequence.DisplayWidth, sequence.DisplayHeight = sequence.Width, sequence.Height
+	}
+
+	// A repeated edit list loops the track for the track duration, indefinitely if it is all ones
+	sequence.LoopCount = 1
+	if track.repeat {
+		switch {
+		case track.indefinite:
+			sequence.LoopCount = 0
+		case track.editDuration > 0:
+			loops := (track.duration + track.editDuration - 1) / track.editDuration
+			if loops > 1 {
+				sequence.LoopCount = int(loops)
+			}
+		}
+	}
+
+	return &sequence, nil
+}
+
+func parseHEIFTrack(payload []byte) (*heifTrack, error) {
+	track := &heifTrack{}
+
+	err := walkISOBoxes(payload, func(boxType string, box []byte) error {
+		switch boxType {
+		case "tkhd":
+			return track.parseTkhd(box)
+		case "edts":
+			return walkISOBoxes(box, func(boxType string, elst []byte) error {
+				if boxType == "elst" {
+					return track.parseElst(elst)
+				}
+				return nil
+			})
+		case "mdia":
+			return track.parseMdia(box)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return track, nil
+}
+
+// Track Header (tkhd) contains the track ID, its duration and the presentation size as 16.16 fixed-point numbers.
+func (t *heifTrack) parseTkhd(box []byte) error {
+	reader := bytes.NewReader(box)
+	version, _, err := readFullBoxHeader(reader)
+	if err != nil {
+		return err
+	}
+
+	// Skip creation and modification times
+	timeSize := int64(4)
+	if version == 1 {
+		timeSize = 8
+	}
+	if _, err := reader.Seek(2*timeSize, io.SeekCurrent); err != nil {
+		return err
+	}
+
+	if t.sequence.TrackID, err = imagebytes.ReadU32(reader, imagebytes.BigEndian); err != nil {
+		return err
+	}
+
+	// Skip reserved
+	if _, err := reader.Seek(4, io.SeekCurrent); err != nil {
+		return err
+	}
+
+	if version == 1 {
+		t.duration, err = imagebytes.ReadU64(reader, imagebytes.BigEndian)
+		t.indefinite = t.duration == indefiniteDurationV1
+	} else {
+		var duration uint32
+		duration, err = imagebytes.ReadU32(reader, imagebytes.BigEndian)
+		t.duration = uint64(duration)
+		t.indefinite = duration == indefiniteDurationV0
+	}
+	if err != nil {
+		return err
+	}
+
+	// Skip reserved, layer, alternate group, volume, reserved and the matrix
+	if _, err := reader.Seek(8+2+2+2+2+36, io.SeekCurrent); err != nil {
+		return err
+	}
+
+	width, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+	if err != nil {
+		return err
+	}
+
+	height, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+	if err != nil {
+		return err
+	}
+
+	t.sequence.DisplayWidth, t.sequence.DisplayHeight = int(width>>16), int(height>>16)
+	t.hasTrackDimensions = true
+	return nil
+}
+
+// Edit List (elst), the repeat flag makes the edits loop for the track duration.
+func (t *heifTrack) parseElst(box []byte) error {
+	reader := bytes.NewReader(box)
+	version, flags, err := readFullBoxHeader(reader)
+	if err != nil {
+		return err
+	}
+
+	count, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+	if err != nil {
+		return err
+	}
+
+	t.repeat = flags&1 != 0
+	for i := uint32(0); i < count; i++ {
+		var segmentDuration uint64
+		if version == 1 {
+			segmentDuration, err = imagebytes.ReadU64(reader, imagebytes.BigEndian)
+		} else {
+			var duration uint32
+			duration, err = imagebytes.ReadU32(reader, imagebytes.BigEndian)
+			segmentDuration = uint64(duration)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Skip media time and media rate
+		mediaTimeSize := int64(4)
+		if version == 1 {
+			mediaTimeSize = 8
+		}
+		if _, err := reader.Seek(mediaTimeSize+4, io.SeekCurrent); err != nil {
+			return err
+		}
+
+		t.editDuration += segmentDuration
+	}
+
+	return nil
+}
+
+// Media (mdia) contains the media header, the handler and the sample tables.
+func (t *heifTrack) parseMdia(box []byte) error {
+	return walkISOBoxes(box, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "mdhd":
+			timescale, duration, err := parseMediaHeader(payload)
+			t.mediaTimescale, t.mediaDuration = timescale, duration
+			return err
+		case "hdlr":
+			// Skip version, flags and pre_defined
+			if len(payload) < 12 {
+				return errors.New("corrupted image: hdlr box is too small")
+			}
+			t.sequence.Handler = string(payload[8:12])
+		case "minf":
+			return walkISOBoxes(payload, func(boxType string, stbl []byte) error {
+				if boxType == "stbl" {
+					return t.parseStbl(stbl)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+// Sample Table (stbl) contains the sample descriptions (stsd) and the decoding times of the samples (stts).
+func (t *heifTrack) parseStbl(box []byte) error {
+	return walkISOBoxes(box, func(boxType string, payload []byte) error {
+		switch boxType {
+		case "stsd":
+			return t.parseStsd(payload)
+		case "stts":
+			return t.parseStts(payload)
+		}
+		return nil
+	})
+}
+
+// Reads the codec and coded size from the first visual sample entry.
+func (t *heifTrack) parseStsd(box []byte) error {
+	// Skip version, flags and entry count
+	if len(box) < 8 {
+		return errors.New("corrupted image: stsd box is too small")
+	}
+
+	return walkISOBoxes(box[8:], func(codec string, entry []byte) error {
+		if t.hasSampleEntry {
+			return nil
+		}
+
+		// Skip reserved, data reference index, pre_defined and reserved fields of VisualSampleEntry
+		const sizeOffset = 6 + 2 + 16
+		if len(entry) < sizeOffset+4 {
+			return errors.New("corrupted image: sample entry is too small")
+		}
+
+		reader := bytes.NewReader(entry[sizeOffset:])
+		width, widthErr := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+		height, heightErr := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+		if widthErr != nil || heightErr != nil {
+			return errors.New("corrupted image: sample entry is too small")
+		}
+
+		t.sequence.Codec = codec
+		t.sequence.Width, t.sequence.Height = int(width), int(height)
+		t.hasSampleEntry = true
+		return nil
+	})
+}
+
+// Time to Sample (stts) is a run-length table of sample durations, the sum of runs is the frame count.
+func (t *heifTrack) parseStts(box []byte) error {
+	reader := bytes.NewReader(box)
+	if _, _, err := readFullBoxHeader(reader); err != nil {
+		return err
+	}
+
+	count, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+	if err != nil {
+		return err
+	}
+
+	for i := uint32(0); i < count; i++ {
+		samples, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+		if err != nil {
+			return err
+		}
+
+		// Skip sample delta
+		if _, err := reader.Seek(4, io.SeekCurrent); err != nil {
+			return err
+		}
+
+		t.sequence.Frames += int(samples)
+	}
+
+	return nil
+}
+
+// Reads the timescale and duration of a Media Header (mdhd).
+func parseMediaHeader(box []byte) (timescale uint32, duration uint64, err error) {
+	reader := bytes.NewReader(box)
+	version, _, err := readFullBoxHeader(reader)
+	if err != nil {
+		return
+	}
+
+	// Skip creation and modification times
+	timeSize := int64(4)
+	if version == 1 {
+		timeSize = 8
+	}
+	if _, err = reader.Seek(2*timeSize, io.SeekCurrent); err != nil {
+		return
+	}
+
+	if timescale, err = imagebytes.ReadU32(reader, imagebytes.BigEndian); err != nil {
+		return
+	}
+
+	if version == 1 {
+		duration, err = imagebytes.ReadU64(reader, imagebytes.BigEndian)
+		return
+	}
+
+	durationU32, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+	return timescale, uint64(durationU32), err
+}
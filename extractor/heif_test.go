@@ -0,0 +1,864 @@
+package extractor_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pillowskiy/imagesize/extractor"
+)
+
+func be16(v uint16) []byte {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, v)
+	return buf
+}
+
+func be32(v uint32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, v)
+	return buf
+}
+
+// Builds an ISOBMFF box with the given type and payload parts.
+func isoBox(boxType string, payloads ...[]byte) []byte {
+	payload := mergeBuffers(payloads...)
+	return mergeBuffers(be32(uint32(8+len(payload))), []byte(boxType), payload)
+}
+
+// Builds the version and flags prefix of a full box.
+func fullBox(version uint8, flags uint32) []byte {
+	return be32(uint32(version)<<24 | flags)
+}
+
+func heifItemEntry(id uint16, itemType string) []byte {
+	return isoBox("infe", fullBox(2, 0), be16(id), be16(0), []byte(itemType), []byte{0x00})
+}
+
+func heifIspe(width, height uint32) []byte {
+	return isoBox("ispe", fullBox(0, 0), be32(width), be32(height))
+}
+
+func heifReference(refType string, from uint16, to ...uint16) []byte {
+	buf := mergeBuffers(be16(from), be16(uint16(len(to))))
+	for _, id := range to {
+		buf = append(buf, be16(id)...)
+	}
+	return isoBox(refType, buf)
+}
+
+// Builds an ipma entry, the properties are 1-based ipco indices.
+func heifAssociation(id uint16, properties ...byte) []byte {
+	return mergeBuffers(be16(id), []byte{byte(len(properties))}, properties)
+}
+
+func heifClap(width, height uint32, horizOff, vertOff int32) []byte {
+	return isoBox("clap",
+		be32(width), be32(1), be32(height), be32(1),
+		be32(uint32(horizOff)), be32(1), be32(uint32(vertOff)), be32(1),
+	)
+}
+
+// Builds a moov box with a single picture track of the given number of frames, 100ms each.
+func heifMovie(width, height uint16, frames uint32, elst []byte) []byte {
+	tkhd := mergeBuffers(
+		fullBox(0, 0), be32(0), be32(0), be32(1), be32(0), be32(0xFFFFFFFF), // times, track ID, indefinite duration
+		make([]byte, 8+2+2+2+2+36),
+		be32(uint32(width)<<16), be32(uint32(height)<<16),
+	)
+
+	sampleEntry := mergeBuffers(make([]byte, 6+2+16), be16(width), be16(height), make([]byte, 50))
+
+	return isoBox("moov",
+		isoBox("trak",
+			isoBox("tkhd", tkhd),
+			isoBox("edts", elst),
+			isoBox("mdia",
+				isoBox("mdhd", fullBox(0, 0), be32(0), be32(0), be32(1000), be32(frames*100)),
+				isoBox("hdlr", fullBox(0, 0), be32(0), []byte("pict"), make([]byte, 13)),
+				isoBox("minf",
+					isoBox("stbl",
+						isoBox("stsd", fullBox(0, 0), be32(1), isoBox("av01", sampleEntry)),
+						isoBox("stts", fullBox(0, 0), be32(1), be32(frames), be32(100)),
+					),
+				),
+			),
+		),
+	)
+}
+
+// bitWriter builds MSB-first bitstreams for codec configuration tests.
+type bitWriter struct {
+	buf  []byte
+	bits int
+}
+
+func (w *bitWriter) writeBits(value uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(value>>uint(i)&1) << (7 - uint(w.bits%8))
+		w.bits++
+	}
+}
+
+// Writes an unsigned Exp-Golomb code.
+func (w *bitWriter) writeUE(value uint64) {
+	n := 0
+	for v := value + 1; v > 1; v >>= 1 {
+		n++
+	}
+	w.writeBits(0, n)
+	w.writeBits(value+1, n+1)
+}
+
+// Inserts emulation prevention bytes, as required in NAL units.
+func escapeRBSP(rbsp []byte) []byte {
+	var buf []byte
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 0x03 {
+			buf = append(buf, 0x03)
+			zeros = 0
+		}
+		buf = append(buf, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return buf
+}
+
+func heifFile(brand string, metaBoxes ...[]byte) []byte {
+	return mergeBuffers(
+		isoBox("ftyp", []byte(brand), be32(0), []byte("mif1"), []byte(brand)),
+		isoBox("meta", fullBox(0, 0), mergeBuffers(metaBoxes...)),
+	)
+}
+
+const hevcNALUnitSPS = 33
+
+func TestHEIF(t *testing.T) {
+	t.Parallel()
+	heif := extractor.HEIF{}
+
+	// Primary image (1) with a larger depth map (2), a thumbnail (3) and an Exif item (4)
+	properties := isoBox("iprp",
+		isoBox("ipco",
+			heifIspe(100, 50),  // 1
+			heifIspe(400, 400), // 2
+			heifIspe(20, 10),   // 3
+			isoBox("auxC", fullBox(0, 0), []byte("urn:mpeg:hevc:2015:auxid:2\x00")), // 4
+			isoBox("irot", []byte{0x01}), // 5
+		),
+		isoBox("ipma", fullBox(0, 0), be32(3),
+			heifAssociation(1, 0x01),
+			heifAssociation(2, 0x02, 0x84, 0x85),
+			heifAssociation(3, 0x03),
+		),
+	)
+
+	items := isoBox("iinf", fullBox(0, 0), be16(4),
+		heifItemEntry(1, "hvc1"),
+		heifItemEntry(2, "hvc1"),
+		heifItemEntry(3, "hvc1"),
+		heifItemEntry(4, "Exif"),
+	)
+
+	references := isoBox("iref", fullBox(0, 0),
+		heifReference("auxl", 2, 1),
+		heifReference("thmb", 3, 1),
+		heifReference("cdsc", 4, 1),
+	)
+
+	validHEIF := heifFile("heic",
+		isoBox("pitm", fullBox(0, 0), be16(1)),
+		items, references, properties,
+	)
+
+	t.Run("FormatDetection", func(t *testing.T) {
+		format, matched := heif.MatchFormat(validHEIF)
+		if !matched {
+			t.Error("expected match for valid HEIF file")
+		}
+
+		expectedFormat := "heic"
+		if format != expectedFormat {
+			t.Errorf("expected format %s, got %s", expectedFormat, format)
+		}
+	})
+
+	t.Run("ContainerFormatOfJPEGBrands", func(t *testing.T) {
+		for _, brand := range []string{"jpeg", "jpgs"} {
+			buf := heifFile(brand,
+				isoBox("pitm", fullBox(0, 0), be16(1)),
+				isoBox("iinf", fullBox(0, 0), be16(1), heifItemEntry(1, "jpeg")),
+				isoBox("iprp",
+					isoBox("ipco", heifIspe(16, 8)),
+					isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, 0x01)),
+				),
+			)
+
+			format, matched := heif.MatchFormat(buf)
+			if !matched || format != "heif" {
+				t.Errorf("expected format heif for brand %s, got %s (matched: %v)", brand, format, matched)
+			}
+
+			info, err := heif.ExtractInfo(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if codec := info.Codec(); codec != "jpeg" {
+				t.Errorf("expected codec jpeg, got %s", codec)
+			}
+		}
+	})
+
+	t.Run("ExtractSizeOfPrimaryItem", func(t *testing.T) {
+		reader := bytes.NewReader(validHEIF)
+		width, height, err := heif.ExtractSize(reader)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if width != 100 {
+			t.Errorf("expected width 100, got %d", width)
+		}
+
+		if height != 50 {
+			t.Errorf("expected height 50, got %d", height)
+		}
+	})
+
+	t.Run("ExtractItems", func(t *testing.T) {
+		info, err := heif.ExtractInfo(bytes.NewReader(validHEIF))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Primary.ID != 1 || info.Primary.Role != extractor.HEIFRolePrimary {
+			t.Errorf("expected primary item 1, got %+v", info.Primary)
+		}
+
+		expected := []struct {
+			id            uint32
+			role          extractor.HEIFItemRole
+			width, height int
+		}{
+			{2, extractor.HEIFRoleDepth, 400, 400},
+			{3, extractor.HEIFRoleThumbnail, 20, 10},
+			{4, extractor.HEIFRoleMetadata, 0, 0},
+		}
+
+		if len(info.Items) != len(expected) {
+			t.Fatalf("expected %d items, got %d", len(expected), len(info.Items))
+		}
+
+		for i, exp := range expected {
+			item := info.Items[i]
+			if item.ID != exp.id || item.Role != exp.role || item.Width != exp.width || item.Height != exp.height {
+				t.Errorf("expected item %+v, got %+v", exp, item)
+			}
+
+			if item.RefItemID != 1 {
+				t.Errorf("expected item %d to refer to the primary item, got %d", item.ID, item.RefItemID)
+			}
+		}
+	})
+
+	t.Run("MissingPrimaryItem", func(t *testing.T) {
+		noPrimary := heifFile("heic", items, references, properties)
+
+		if _, _, err := heif.ExtractSize(bytes.NewReader(noPrimary)); err == nil {
+			t.Fatal("expected error due to missing pitm, got nil")
+		}
+
+		fallback := heif
+		fallback.FallbackToLargest = true
+
+		info, err := fallback.ExtractInfo(bytes.NewReader(noPrimary))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !info.Largest {
+			t.Error("expected size to be taken from the largest ispe")
+		}
+
+		if info.Width != 400 || info.Height != 400 {
+			t.Errorf("expected size 400x400, got %dx%d", info.Width, info.Height)
+		}
+	})
+
+	t.Run("TransformationsInIpmaOrder", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			properties    []byte
+			width, height int
+		}{
+			{
+				name:       "CropThenRotate",
+				properties: []byte{0x01, 0x82, 0x83, 0x84},
+				width:      3000, height: 4000,
+			},
+			{
+				name:       "RotateThenCrop",
+				properties: []byte{0x01, 0x83, 0x85, 0x84},
+				width:      2000, height: 4000,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				buf := heifFile("heic",
+					isoBox("pitm", fullBox(0, 0), be16(1)),
+					isoBox("iinf", fullBox(0, 0), be16(1), heifItemEntry(1, "hvc1")),
+					isoBox("iprp",
+						isoBox("ipco",
+							heifIspe(4032, 3024),          // 1
+							heifClap(4000, 3000, 0, 0),    // 2
+							isoBox("irot", []byte{0x01}),  // 3
+							isoBox("imir", []byte{0x01}),  // 4
+							heifClap(2000, 4000, -500, 0), // 5
+						),
+						isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, tt.properties...)),
+					),
+				)
+
+				info, err := heif.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.Primary.Width != 4032 || info.Primary.Height != 3024 {
+					t.Errorf("expected coded size 4032x3024, got %dx%d", info.Primary.Width, info.Primary.Height)
+				}
+
+				if info.Width != tt.width || info.Height != tt.height {
+					t.Errorf("expected display size %dx%d, got %dx%d", tt.width, tt.height, info.Width, info.Height)
+				}
+
+				if len(info.Primary.Transformations) != 3 {
+					t.Fatalf("expected 3 transformations, got %d", len(info.Primary.Transformations))
+				}
+
+				last := info.Primary.Transformations[2]
+				if last.Type != "imir" || last.Axis != 1 {
+					t.Errorf("expected imir about the horizontal axis to be applied last, got %+v", last)
+				}
+			})
+		}
+	})
+
+	t.Run("InvalidCleanAperture", func(t *testing.T) {
+		buf := heifFile("heic",
+			isoBox("pitm", fullBox(0, 0), be16(1)),
+			isoBox("iinf", fullBox(0, 0), be16(1), heifItemEntry(1, "hvc1")),
+			isoBox("iprp",
+				isoBox("ipco", heifIspe(100, 100), heifClap(200, 100, 0, 0)),
+				isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, 0x01, 0x82)),
+			),
+		)
+
+		if _, _, err := heif.ExtractSize(bytes.NewReader(buf)); err == nil {
+			t.Fatal("expected error due to clean aperture larger than the image, got nil")
+		}
+	})
+
+	t.Run("ExtractSequenceWithoutMeta", func(t *testing.T) {
+		buf := mergeBuffers(
+			isoBox("ftyp", []byte("avis"), be32(0), []byte("msf1avis")),
+			heifMovie(64, 48, 12, isoBox("elst", fullBox(0, 1), be32(1), be32(1200), be32(0), be32(0x10000))),
+		)
+
+		info, err := heif.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !info.FromSequence || info.Width != 64 || info.Height != 48 {
+			t.Errorf("expected 64x48 from the sequence, got %dx%d (from sequence: %v)", info.Width, info.Height, info.FromSequence)
+		}
+
+		sequence := info.Sequence
+		if sequence.Codec != "av01" || sequence.Frames != 12 || sequence.Duration != 1200*time.Millisecond {
+			t.Errorf("expected 12 av01 frames in 1.2s, got %+v", sequence)
+		}
+
+		if sequence.LoopCount != 0 {
+			t.Errorf("expected infinite loop, got %d loops", sequence.LoopCount)
+		}
+	})
+
+	t.Run("ExtractSequenceAlongsideMeta", func(t *testing.T) {
+		buf, err := os.ReadFile("../_testdata/heic/heic_msf1.heic")
+		if err != nil {
+			t.Fatalf("failed to read test file: %v", err)
+		}
+
+		info, err := heif.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.FromSequence || info.Primary.Type != "hvc1" {
+			t.Errorf("expected size of the primary item, got %+v", info)
+		}
+
+		if info.Sequence != nil {
+			t.Errorf("expected the sequence to be read only when its size is reported, got %+v", info.Sequence)
+		}
+
+		preferred := heif
+		preferred.PreferSequence = true
+
+		info, err = preferred.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !info.FromSequence || info.Width != 1280 || info.Height != 720 {
+			t.Errorf("expected 1280x720 from the sequence, got %dx%d (from sequence: %v)", info.Width, info.Height, info.FromSequence)
+		}
+
+		sequence := info.Sequence
+		if sequence == nil {
+			t.Fatal("expected sequence to be reported")
+		}
+
+		if sequence.Frames != 8 || sequence.Duration != 1600*time.Millisecond || sequence.LoopCount != 1 {
+			t.Errorf("expected 8 frames in 1.6s played once, got %+v", sequence)
+		}
+	})
+
+	t.Run("OversizedSequenceAlongsideMeta", func(t *testing.T) {
+		// moov box larger than the boxes read into memory, followed by nothing
+		buf := mergeBuffers(
+			heifFile("heic",
+				isoBox("pitm", fullBox(0, 0), be16(1)),
+				isoBox("iinf", fullBox(0, 0), be16(1), heifItemEntry(1, "hvc1")),
+				isoBox("iprp",
+					isoBox("ipco", heifIspe(64, 32)),
+					isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, 0x81)),
+				),
+			),
+			be32(32<<20), []byte("moov"),
+		)
+
+		for _, preferSequence := range []bool{false, true} {
+			decoder := heif
+			decoder.PreferSequence = preferSequence
+
+			info, err := decoder.ExtractInfo(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatalf("expected no error (prefer sequence: %v), got %v", preferSequence, err)
+			}
+
+			if info.FromSequence || info.Width != 64 || info.Height != 32 {
+				t.Errorf("expected 64x32 from the primary item (prefer sequence: %v), got %+v", preferSequence, info)
+			}
+		}
+	})
+
+	t.Run("DecodeCodecConfig", func(t *testing.T) {
+		// av1C of a 20x20 8-bit 4:4:4 image with a reduced still picture sequence header
+		av1C := isoBox("av1C", []byte{0x81, 0x20, 0x00, 0x00, 0x0A, 0x08, 0x38, 0x11, 0x27, 0x36, 0x90, 0x10, 0xD0, 0x02})
+
+		tests := []struct {
+			name          string
+			properties    []byte
+			width, height int
+			mismatch      bool
+		}{
+			{name: "MatchingIspe", properties: []byte{0x81, 0x02}, width: 20, height: 20},
+			{name: "BogusIspe", properties: []byte{0x81, 0x03}, width: 30, height: 30, mismatch: true},
+			{name: "MissingIspe", properties: []byte{0x81}, width: 20, height: 20},
+		}
+
+		decoder := heif
+		decoder.DecodeCodecConfig = true
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				buf := heifFile("avif",
+					isoBox("pitm", fullBox(0, 0), be16(1)),
+					isoBox("iinf", fullBox(0, 0), be16(1), heifItemEntry(1, "av01")),
+					isoBox("iprp",
+						isoBox("ipco", av1C, heifIspe(20, 20), heifIspe(30, 30)),
+						isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, tt.properties...)),
+					),
+				)
+
+				info, err := decoder.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.Width != tt.width || info.Height != tt.height {
+					t.Errorf("expected size %dx%d, got %dx%d", tt.width, tt.height, info.Width, info.Height)
+				}
+
+				config := info.Primary.CodecConfig
+				if config == nil {
+					t.Fatal("expected codec configuration to be decoded")
+				}
+
+				if config.Width != 20 || config.Height != 20 || config.SizeMismatch != tt.mismatch {
+					t.Errorf("expected coded size 20x20 (mismatch: %v), got %+v", tt.mismatch, config)
+				}
+
+				if config.BitDepth != 8 || config.ChromaSubsampling != "4:4:4" {
+					t.Errorf("expected 8-bit 4:4:4, got %+v", config)
+				}
+			})
+		}
+
+		t.Run("HEVCConformanceWindow", func(t *testing.T) {
+			sps := &bitWriter{}
+			sps.writeBits(0, 4)  // sps_video_parameter_set_id
+			sps.writeBits(0, 3)  // sps_max_sub_layers_minus1
+			sps.writeBits(1, 1)  // sps_temporal_id_nesting_flag
+			sps.writeBits(0, 96) // profile_tier_level
+			sps.writeUE(0)       // sps_seq_parameter_set_id
+			sps.writeUE(1)       // chroma_format_idc (4:2:0)
+			sps.writeUE(1920)    // pic_width_in_luma_samples
+			sps.writeUE(1088)    // pic_height_in_luma_samples
+			sps.writeBits(1, 1)  // conformance_window_flag
+			sps.writeUE(0)       // conf_win_left_offset
+			sps.writeUE(0)       // conf_win_right_offset
+			sps.writeUE(0)       // conf_win_top_offset
+			sps.writeUE(4)       // conf_win_bottom_offset (in chroma rows)
+			sps.writeUE(2)       // bit_depth_luma_minus8
+			sps.writeUE(2)       // bit_depth_chroma_minus8
+			sps.writeBits(1, 1)  // rbsp_stop_one_bit
+
+			nal := mergeBuffers([]byte{0x42, 0x01}, escapeRBSP(sps.buf))
+			hvcC := isoBox("hvcC",
+				make([]byte, 22), []byte{0x01}, // record header, 1 array
+				[]byte{hevcNALUnitSPS}, be16(1), be16(uint16(len(nal))), nal,
+			)
+
+			buf := heifFile("heic",
+				isoBox("pitm", fullBox(0, 0), be16(1)),
+				isoBox("iinf", fullBox(0, 0), be16(1), heifItemEntry(1, "hvc1")),
+				isoBox("iprp",
+					isoBox("ipco", hvcC, heifIspe(1920, 1080)),
+					isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, 0x81, 0x02)),
+				),
+			)
+
+			info, err := decoder.ExtractInfo(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			config := info.Primary.CodecConfig
+			if config == nil || config.Width != 1920 || config.Height != 1080 || config.SizeMismatch {
+				t.Fatalf("expected cropped size 1920x1080 matching ispe, got %+v", config)
+			}
+
+			if config.BitDepth != 10 || config.ChromaBitDepth != 10 || config.ChromaSubsampling != "4:2:0" {
+				t.Errorf("expected 10-bit 4:2:0, got %+v", config)
+			}
+		})
+
+		t.Run("HEVC", func(t *testing.T) {
+			buf, err := os.ReadFile("../_testdata/heic/heic_msf1.heic")
+			if err != nil {
+				t.Fatalf("failed to read test file: %v", err)
+			}
+
+			info, err := decoder.ExtractInfo(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			config := info.Primary.CodecConfig
+			if config == nil || config.Width != 1280 || config.Height != 720 || config.SizeMismatch {
+				t.Errorf("expected coded size 1280x720 matching ispe, got %+v", config)
+			}
+
+			if config != nil && (config.BitDepth != 8 || config.ChromaSubsampling != "4:2:0") {
+				t.Errorf("expected 8-bit 4:2:0, got %+v", config)
+			}
+		})
+
+		t.Run("UndecodableConfig", func(t *testing.T) {
+			// av1C without configOBUs (1), and truncated hvcC (2)
+			bare := isoBox("av1C", []byte{0x81, 0x20, 0x00, 0x00})
+			truncated := isoBox("hvcC", make([]byte, 10))
+
+			// Primary item (1) with a thumbnail (2)
+			file := func(primary []byte) []byte {
+				return heifFile("avif",
+					isoBox("pitm", fullBox(0, 0), be16(1)),
+					isoBox("iinf", fullBox(0, 0), be16(2), heifItemEntry(1, "av01"), heifItemEntry(2, "hvc1")),
+					isoBox("iref", fullBox(0, 0), heifReference("thmb", 2, 1)),
+					isoBox("iprp",
+						isoBox("ipco", bare, truncated, heifIspe(20, 20), heifIspe(10, 10)),
+						isoBox("ipma", fullBox(0, 0), be32(2), heifAssociation(1, primary...), heifAssociation(2, 0x82, 0x04)),
+					),
+				)
+			}
+
+			info, err := decoder.ExtractInfo(bytes.NewReader(file([]byte{0x81, 0x03})))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if info.Width != 20 || info.Height != 20 || info.Primary.CodecConfig != nil {
+				t.Errorf("expected 20x20 from ispe without codec configuration, got %+v", info.Primary)
+			}
+
+			if len(info.Items) != 1 || info.Items[0].Width != 10 || info.Items[0].CodecConfig != nil {
+				t.Errorf("expected 10x10 thumbnail without codec configuration, got %+v", info.Items)
+			}
+
+			// The size of the primary item depends on its configuration without ispe
+			if _, err := decoder.ExtractInfo(bytes.NewReader(file([]byte{0x82}))); err == nil {
+				t.Error("expected error due to undecodable configuration of the primary item without ispe, got nil")
+			}
+		})
+	})
+
+	t.Run("ExtractGainMap", func(t *testing.T) {
+		// Base image (1) with a gain map (2), combined by a tone map item (3) or referring to the base
+		properties := isoBox("iprp",
+			isoBox("ipco",
+				heifIspe(100, 50), // 1
+				heifIspe(50, 25),  // 2
+				isoBox("auxC", fullBox(0, 0), []byte("urn:com:apple:photo:2020:aux:hdrgainmap\x00")), // 3
+			),
+			isoBox("ipma", fullBox(0, 0), be32(3),
+				heifAssociation(1, 0x01),
+				heifAssociation(2, 0x02, 0x03),
+				heifAssociation(3, 0x01),
+			),
+		)
+
+		tests := []struct {
+			name       string
+			references []byte
+			source     extractor.GainMapSource
+		}{
+			{
+				name:       "ToneMapItem",
+				references: isoBox("iref", fullBox(0, 0), heifReference("dimg", 3, 1, 2)),
+				source:     extractor.GainMapISO21496,
+			},
+			{
+				name:       "AppleAuxiliaryImage",
+				references: isoBox("iref", fullBox(0, 0), heifReference("auxl", 2, 1)),
+				source:     extractor.GainMapApple,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				buf := heifFile("heic",
+					isoBox("pitm", fullBox(0, 0), be16(1)),
+					isoBox("iinf", fullBox(0, 0), be16(3),
+						heifItemEntry(1, "hvc1"),
+						heifItemEntry(2, "hvc1"),
+						heifItemEntry(3, "tmap"),
+					),
+					tt.references, properties,
+				)
+
+				info, err := heif.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.Width != 100 || info.Height != 50 {
+					t.Errorf("expected base image size 100x50, got %dx%d", info.Width, info.Height)
+				}
+
+				expected := extractor.GainMap{Source: tt.source, Width: 50, Height: 25}
+				if info.GainMap == nil || *info.GainMap != expected {
+					t.Errorf("expected gain map %+v, got %+v", expected, info.GainMap)
+				}
+
+				if info.Items[0].Role != extractor.HEIFRoleGainMap {
+					t.Errorf("expected gain map role of item 2, got %s", info.Items[0].Role)
+				}
+			})
+		}
+
+		info, err := heif.ExtractInfo(bytes.NewReader(validHEIF))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.GainMap != nil {
+			t.Errorf("expected no gain map, got %+v", info.GainMap)
+		}
+	})
+
+	t.Run("CorruptedImage", func(t *testing.T) {
+		truncated := validHEIF[:len(validHEIF)-10]
+
+		if _, _, err := heif.ExtractSize(bytes.NewReader(truncated)); err == nil {
+			t.Fatal("expected error due to truncated meta box, got nil")
+		}
+	})
+
+	t.Run("ExtractGridItems", func(t *testing.T) {
+		buf, err := os.ReadFile("../_testdata/heic/heic.heic")
+		if err != nil {
+			t.Fatalf("failed to read test file: %v", err)
+		}
+
+		info, err := heif.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Primary.Type != "grid" {
+			t.Errorf("expected grid primary item, got %s", info.Primary.Type)
+		}
+
+		if codec := info.Codec(); codec != "hvc1" {
+			t.Errorf("expected codec of the grid tiles hvc1, got %s", codec)
+		}
+
+		var tiles, thumbnails int
+		for _, item := range info.Items {
+			switch item.Role {
+			case extractor.HEIFRoleTile:
+				tiles++
+			case extractor.HEIFRoleThumbnail:
+				thumbnails++
+				if item.Width != 320 || item.Height != 240 {
+					t.Errorf("expected thumbnail size 320x240, got %dx%d", item.Width, item.Height)
+				}
+			}
+		}
+
+		if tiles != 35 || thumbnails != 1 {
+			t.Errorf("expected 35 tiles and 1 thumbnail, got %d and %d", tiles, thumbnails)
+		}
+	})
+
+	t.Run("ExifOrientation", func(t *testing.T) {
+		// Exif item data starts with the offset of the TIFF header, followed by data that is never read
+		exif := mergeBuffers(be32(6), exifBlock(binary.LittleEndian, []tiffTestEntry{
+			tiffShort(binary.LittleEndian, 0x0112, uint16(extractor.OrientationRotate180)),
+			tiffRational(binary.LittleEndian, 0x011A, 300, 1),
+			tiffRational(binary.LittleEndian, 0x011B, 300, 1),
+		}), make([]byte, 64<<10))
+
+		exifFile := func(properties, iloc []byte, extra ...[]byte) []byte {
+			return heifFile("heic", mergeBuffers(
+				isoBox("pitm", fullBox(0, 0), be16(1)),
+				isoBox("iinf", fullBox(0, 0), be16(2), heifItemEntry(1, "hvc1"), heifItemEntry(2, "Exif")),
+				isoBox("iref", fullBox(0, 0), heifReference("cdsc", 2, 1)),
+				isoBox("iprp",
+					isoBox("ipco", heifIspe(100, 50), isoBox("irot", []byte{0x03}), isoBox("imir", []byte{0x01})),
+					isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, properties...)),
+				),
+				iloc,
+			), mergeBuffers(extra...))
+		}
+
+		// Offset and length fields of 4 bytes, no base offset and index
+		idatFile := func(properties []byte) []byte {
+			return exifFile(properties, isoBox("iloc", fullBox(1, 0), []byte{0x44, 0x00}, be16(1),
+				be16(2), be16(1), be16(0), be16(1), be32(0), be32(uint32(len(exif))),
+			), isoBox("idat", exif))
+		}
+
+		fileOffsetILoc := func(offset uint32) []byte {
+			return isoBox("iloc", fullBox(0, 0), []byte{0x44, 0x00}, be16(1),
+				be16(2), be16(0), be16(1), be32(offset), be32(uint32(len(exif))),
+			)
+		}
+		fileOffsetFile := func(properties []byte) []byte {
+			offset := uint32(len(exifFile(properties, fileOffsetILoc(0))) + 8)
+			return mergeBuffers(exifFile(properties, fileOffsetILoc(offset)), isoBox("mdat", exif))
+		}
+
+		tests := []struct {
+			name          string
+			buf           []byte
+			orientation   extractor.Orientation
+			width, height int
+			inMeta        bool
+		}{
+			// irot already rotates the image, the EXIF orientation is reported even though it disagrees
+			// with irot, but it must not be applied again
+			{name: "Idat", buf: idatFile([]byte{0x01, 0x82}), orientation: extractor.OrientationRotate180, width: 50, height: 100, inMeta: true},
+			{name: "FileOffset", buf: fileOffsetFile([]byte{0x01, 0x82}), orientation: extractor.OrientationRotate180, width: 50, height: 100},
+			// Rotated by 90 degrees clockwise, then mirrored top to bottom
+			{name: "RotatedAndMirrored", buf: fileOffsetFile([]byte{0x01, 0x82, 0x83}), orientation: extractor.OrientationRotate180, width: 50, height: 100},
+			{name: "Exif", buf: fileOffsetFile([]byte{0x01}), orientation: extractor.OrientationRotate180, width: 100, height: 50},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				reader := &countingReader{ReadSeeker: bytes.NewReader(tt.buf)}
+				info, err := heif.ExtractInfo(reader)
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.Orientation != tt.orientation {
+					t.Errorf("expected orientation %d, got %d", tt.orientation, info.Orientation)
+				}
+
+				if info.DisplayWidth != tt.width || info.DisplayHeight != tt.height {
+					t.Errorf("expected display size %dx%d, got %dx%d", tt.width, tt.height, info.DisplayWidth, info.DisplayHeight)
+				}
+
+				if info.ResolutionSource != extractor.ResolutionEXIF || info.XDPI != 300 || info.YDPI != 300 {
+					t.Errorf("expected 300 DPI from the Exif item, got %+v", info.Resolution)
+				}
+
+				// Only IFD0 and its values are read from the Exif item
+				if !tt.inMeta && reader.read > len(tt.buf)-len(exif)+1024 {
+					t.Errorf("expected the Exif item to be read partially, got %d bytes read", reader.read)
+				}
+			})
+		}
+	})
+
+	t.Run("OversizedItemExtent", func(t *testing.T) {
+		// Exif item of two extents with 8-byte lengths, the second one spanning almost 2^64 bytes
+		buf := heifFile("heic",
+			isoBox("pitm", fullBox(0, 0), be16(1)),
+			isoBox("iinf", fullBox(0, 0), be16(2), heifItemEntry(1, "hvc1"), heifItemEntry(2, "Exif")),
+			isoBox("iref", fullBox(0, 0), heifReference("cdsc", 2, 1)),
+			isoBox("iprp",
+				isoBox("ipco", heifIspe(100, 50)),
+				isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, 0x01)),
+			),
+			isoBox("iloc", fullBox(0, 0), []byte{0x48, 0x00}, be16(1),
+				be16(2), be16(0), be16(2),
+				be32(0), be32(0), be32(1),
+				be32(0), be32(0xFFFFFFFF), be32(0xFFFFFFFF),
+			),
+		)
+
+		info, err := heif.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Width != 100 || info.Height != 50 {
+			t.Errorf("expected 100x50, got %dx%d", info.Width, info.Height)
+		}
+	})
+
+	t.Run("InvalidImageFormatDetection", func(t *testing.T) {
+		_, matched := heif.MatchFormat([]byte("NOTHEIFHEADERBUFFER12345"))
+		if matched {
+			t.Error("expected no match for non-HEIF file")
+		}
+	})
+}
@@ -0,0 +1,143 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pillowskiy/imagesize/imagebytes"
+)
+
+// Upper bound for boxes that are read into memory as a whole (e.g. meta).
+// Real-world meta boxes are a few kilobytes, anything above this is treated as corrupted.
+const maxISOBoxSize = 16 << 20
+
+var errInvalidBoxSize = errors.New("invalid HEIF box size")
+
+// isoBoxHeader describes a box of the ISO Base Media File Format (ISO/IEC 14496-12).
+// See https://en.wikipedia.org/wiki/ISO_base_media_file_format
+type isoBoxHeader struct {
+	Type string
+
+	// Size of the box including the header, -1 if the box extends to the end of the file.
+	Size int64
+
+	// Size of the header (8 bytes, or 16 bytes for 64-bit box sizes).
+	HeaderSize int64
+}
+
+// PayloadSize returns the size of the box without its header, -1 if unknown.
+func (h isoBoxHeader) PayloadSize() int64 {
+	if h.Size < 0 {
+		return -1
+	}
+	return h.Size - h.HeaderSize
+}
+
+// Reads a box header from the provided reader, leaving it positioned at the box payload.
+func readISOBoxHeader(reader io.Reader) (header isoBoxHeader, err error) {
+	tag, size, err := imagebytes.ReadTag(reader)
+	if err != nil {
+		return
+	}
+
+	header.Type = tag
+	header.HeaderSize = 8
+
+	switch size {
+	case 0: // Box extends to the end of the file
+		header.Size = -1
+		return
+	case 1: // 64-bit box size follows the type
+		largeSize, sizeErr := imagebytes.ReadU64(reader, imagebytes.BigEndian)
+		if sizeErr != nil {
+			err = sizeErr
+			return
+		}
+		header.HeaderSize = 16
+		header.Size = int64(largeSize)
+	default:
+		header.Size = int64(size)
+	}
+
+	if header.Size < header.HeaderSize {
+		err = errInvalidBoxSize
+	}
+	return
+}
+
+// Reads the payload of a box whose header was just read.
+func readISOBoxPayload(reader io.Reader, header isoBoxHeader) ([]byte, error) {
+	size := header.PayloadSize()
+	if size < 0 || size > maxISOBoxSize {
+		return nil, fmt.Errorf("%s box is too large", header.Type)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, fmt.Errorf("failed to read %s box: %w", header.Type, err)
+	}
+	return payload, nil
+}
+
+// Calls fn for every box contained in buf, in order.
+func walkISOBoxes(buf []byte, fn func(boxType string, payload []byte) error) error {
+	reader := bytes.NewReader(buf)
+	for len(buf) > 0 {
+		reader.Reset(buf)
+		header, err := readISOBoxHeader(reader)
+		if err != nil {
+			return err
+		}
+
+		size := header.Size
+		if size < 0 {
+			size = int64(len(buf))
+		}
+		if size > int64(len(buf)) {
+			return errInvalidBoxSize
+		}
+
+		if err := fn(header.Type, buf[header.HeaderSize:size]); err != nil {
+			return err
+		}
+		buf = buf[size:]
+	}
+
+	return nil
+}
+
+// Reads the version and flags that prefix every full box.
+func readFullBoxHeader(reader io.Reader) (version uint8, flags uint32, err error) {
+	versionAndFlags, err := imagebytes.ReadU32(reader, imagebytes.BigEndian)
+	if err != nil {
+		return
+	}
+
+	return uint8(versionAndFlags >> 24), versionAndFlags & 0xFFFFFF, nil
+}
+
+// Reads an item ID, which is 16-bit wide for version 0 boxes and 32-bit wide otherwise.
+func readItemID(reader io.Reader, version uint8) (uint32, error) {
+	if version == 0 {
+		id, err := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+		return uint32(id), err
+	}
+	return imagebytes.ReadU32(reader, imagebytes.BigEndian)
+}
+
+// Reads a null-terminated string, consuming the terminator.
+func readCString(reader io.ByteReader) (string, error) {
+	var buf []byte
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return string(buf), err
+		}
+		if b == 0 {
+			return string(buf), nil
+		}
+		buf = append(buf, b)
+	}
+}
@@ -1,10 +1,13 @@
 package extractor
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/pillowskiy/imagesize/imagebytes"
 	"github.com/pillowskiy/imagesize/imagerrors"
@@ -24,7 +27,285 @@ var jpegHeader = []byte("\xFF\xD8\xFF")
 // 3. After the SOI marker, there is typically a segment containing the JPEG quantization table (0xDB),
 // followed by other segments, including the Huffman table (0xC4), Start of Frame (0xC0), and the Start of Scan (0xDA) markers, which contain the image data.
 // 4. The file ends with a 2-byte marker (0xFF, 0xD9), known as the End of Image (EOI) marker. This marks the conclusion of the JPEG file.
-type JPEG struct{}
+type JPEG struct {
+	// EstimateQuality reads the quantization tables defined before the first scan
+	// to estimate the quality the image was encoded with, see JPEGInfo.Quality.
+	EstimateQuality bool
+
+	// CountScans walks the whole file, skipping the entropy-coded data of each scan,
+	// to count the scans of the image and to detect truncated files, see JPEGInfo.Scans.
+	CountScans bool
+
+	// ReadEmbeddedImages runs the extractor on the images embedded in the file, the EXIF thumbnail
+	// and the images listed by the MPF index, to report their dimensions, see JPEGInfo.EmbeddedImages.
+	ReadEmbeddedImages bool
+
+	// ReadColorProfile reassembles the ICC profile of the APP2 segments, see JPEGInfo.ColorProfile.
+	ReadColorProfile bool
+
+	// ReadXMP reads the XMP packet of the APP1 segments along with its Extended XMP, see JPEGInfo.XMP.
+	ReadXMP bool
+
+	// ReadEXIF decodes the capture time, camera, lens, exposure settings and GPS position
+	// of the EXIF data, see JPEGInfo.EXIF.
+	ReadEXIF bool
+
+	// embedded reads an image embedded in another file up to its frame header,
+	// without its metadata so that the images it embeds itself are never read.
+	embedded bool
+}
+
+const (
+	jpegMarkerDHT = 0xC4
+	jpegMarkerDQT = 0xDB
+	jpegMarkerJPG = 0xC8
+	jpegMarkerDAC = 0xCC
+	jpegMarkerSOS = 0xDA
+	jpegMarkerEOI = 0xD9
+	jpegMarkerDHP = 0xDE
+
+	jpegMarkerAPP0  = 0xE0
+	jpegMarkerAPP1  = 0xE1
+	jpegMarkerAPP2  = 0xE2
+	jpegMarkerAPP14 = 0xEE
+)
+
+// Size of the identifiers read to tell whether APP segments are needed,
+// the longest being "http://ns.adobe.com/xmp/extension/\0".
+const jpegIdentifierSize = 35
+
+var (
+	jfifHeader       = []byte("JFIF\x00")
+	adobeHeader      = []byte("Adobe")
+	iccProfileHeader = []byte("ICC_PROFILE\x00")
+
+	xmpExtensionHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+)
+
+// JPEGProcess is the coding process of a JPEG image, as signalled by its Start of Frame marker.
+type JPEGProcess uint8
+
+const (
+	// JPEGBaseline is the baseline sequential DCT process (SOF0).
+	JPEGBaseline JPEGProcess = iota
+
+	// JPEGExtended is the extended sequential DCT process (SOF1, SOF5, SOF9, SOF13).
+	JPEGExtended
+
+	// JPEGProgressive is the progressive DCT process (SOF2, SOF6, SOF10, SOF14).
+	JPEGProgressive
+
+	// JPEGLossless is the lossless process (SOF3, SOF7, SOF11, SOF15).
+	JPEGLossless
+)
+
+func (p JPEGProcess) String() string {
+	switch p {
+	case JPEGBaseline:
+		return "baseline"
+	case JPEGExtended:
+		return "extended"
+	case JPEGProgressive:
+		return "progressive"
+	case JPEGLossless:
+		return "lossless"
+	default:
+		return "unknown"
+	}
+}
+
+// JPEGColorSpace is the color space of the components of a JPEG image, as determined by decoders
+// from the number of components, the JFIF and Adobe APP14 segments and the component identifiers.
+type JPEGColorSpace uint8
+
+const (
+	JPEGColorSpaceUnknown JPEGColorSpace = iota
+	JPEGColorSpaceGrayscale
+	JPEGColorSpaceYCbCr
+	JPEGColorSpaceRGB
+	JPEGColorSpaceCMYK
+	JPEGColorSpaceYCCK
+)
+
+func (c JPEGColorSpace) String() string {
+	switch c {
+	case JPEGColorSpaceGrayscale:
+		return "Grayscale"
+	case JPEGColorSpaceYCbCr:
+		return "YCbCr"
+	case JPEGColorSpaceRGB:
+		return "RGB"
+	case JPEGColorSpaceCMYK:
+		return "CMYK"
+	case JPEGColorSpaceYCCK:
+		return "YCCK"
+	default:
+		return "Unknown"
+	}
+}
+
+// Values of the transform flag of the Adobe APP14 segment.
+const (
+	adobeTransformNone  = 0
+	adobeTransformYCbCr = 1
+	adobeTransformYCCK  = 2
+)
+
+// JPEGComponent describes a component of the frame header.
+type JPEGComponent struct {
+	ID uint8
+
+	// Sampling factors (1-4), relative to the other components.
+	HorizontalSampling uint8
+	VerticalSampling   uint8
+
+	// Quantization table selector.
+	QuantizationTable uint8
+}
+
+// JPEGInfo contains the information extracted from a JPEG file.
+type JPEGInfo struct {
+	Width  int
+	Height int
+
+	// Start of Frame marker the size was read from (0xC0-0xCF).
+	SOFMarker byte
+
+	Process JPEGProcess
+
+	// Arithmetic reports arithmetic entropy coding, Huffman coding otherwise.
+	Arithmetic bool
+
+	// Hierarchical reports a hierarchical image, whose frames progressively refine the resolution.
+	// Its size is read from the Define Hierarchical Progression segment rather than from the first frame,
+	// which may have a reduced resolution. Also set for differential frames without such segment.
+	Hierarchical bool
+
+	// Progressive reports a progressive image, a shorthand for Process == JPEGProgressive.
+	// Such images are refined over several scans.
+	Progressive bool
+
+	// Bits per sample: 8 or 12 for DCT processes, 2 to 16 for the lossless process.
+	Precision uint8
+
+	// Components of the frame, e.g. Y, Cb and Cr.
+	Components []JPEGComponent
+
+	// Adobe reports an Adobe APP14 segment, whose AdobeTransform tells how the components are coded:
+	// 0 for RGB or CMYK, 1 for YCbCr and 2 for YCCK.
+	Adobe          bool
+	AdobeTransform uint8
+
+	ColorSpace JPEGColorSpace
+
+	// Quality is the libjpeg quality factor (1-100) whose scaled standard tables are the closest
+	// to the quantization tables of the image. It is estimated with JPEG.EstimateQuality and 0 otherwise,
+	// or when the image has no quantization tables (e.g. lossless images).
+	Quality int
+
+	// Scans is the number of Start of Scan markers, counted with JPEG.CountScans. Baseline images
+	// usually have a single scan while progressive images have several.
+	Scans int
+
+	// Truncated reports that the file ends before its End of Image marker, it is only set with JPEG.CountScans.
+	Truncated bool
+
+	// Orientation from the EXIF data of the APP1 segment and the display size according to it.
+	OrientedSize
+
+	// Resolution from the density of the JFIF APP0 segment, or else from the EXIF data.
+	// ResolutionConflict reports that both are present and differ.
+	Resolution
+
+	// Images embedded in the file: the thumbnail of the EXIF data, followed by the images listed
+	// by the MPF index of multi-picture files (MPO), the first of which is the primary image.
+	EmbeddedImages []JPEGEmbeddedImage
+
+	// Gain map of Ultra HDR files, nil if the file has none.
+	GainMap *GainMap
+
+	// ICC profile of the APP2 segments, read with JPEG.ReadColorProfile.
+	// Nil otherwise or when the profile is missing, incomplete or too large.
+	ColorProfile *ColorProfile
+
+	// XMP packet of the APP1 segments, or else of the EXIF data, read with JPEG.ReadXMP.
+	// Nil otherwise or when the file has none.
+	XMP *XMP
+
+	// Fields of the EXIF data of the APP1 segment, read with JPEG.ReadEXIF.
+	// Nil otherwise or when the file has no valid EXIF data.
+	EXIF *EXIF
+
+	// Chunks of the ICC profile by sequence number.
+	iccChunks [][]byte
+
+	// Extended XMP by GUID, reassembled from the APP1 segments.
+	xmpExtensions map[string]*jpegXMPExtension
+
+	// XMP packet of the APP1 segment, without its namespace prefix, read with JPEG.ReadXMP.
+	// Its location is kept otherwise.
+	xmp       []byte
+	xmpOffset int64
+	xmpSize   int
+
+	// EXIF data of the APP1 segment, without the "Exif\0\0" prefix, and its offset in the file.
+	exif       []byte
+	exifOffset int64
+
+	// MP Index IFD of the APP2 MPF segment, without the "MPF\0" prefix, and its offset in the file.
+	mpf       []byte
+	mpfOffset int64
+
+	// Resolution from the JFIF APP0 segment.
+	jfif Resolution
+
+	// hasJFIF reports a JFIF APP0 segment, which implies YCbCr for 3 components.
+	hasJFIF bool
+
+	// Quantization tables by destination, read with JPEG.EstimateQuality.
+	quantTables [4]*jpegQuantTable
+}
+
+// ChromaSubsampling returns the subsampling of the chroma components relative to the first (luma) component,
+// such as "4:4:4", "4:2:2" or "4:2:0", or an empty string for images with less than 3 components
+// or with a layout that has no common notation.
+func (i *JPEGInfo) ChromaSubsampling() string {
+	if len(i.Components) < 3 {
+		return ""
+	}
+
+	luma, cb, cr := i.Components[0], i.Components[1], i.Components[2]
+	if cb.HorizontalSampling != cr.HorizontalSampling || cb.VerticalSampling != cr.VerticalSampling ||
+		cb.HorizontalSampling == 0 || cb.VerticalSampling == 0 ||
+		luma.HorizontalSampling%cb.HorizontalSampling != 0 || luma.VerticalSampling%cb.VerticalSampling != 0 {
+		return ""
+	}
+
+	// Extra components (K of CMYK and YCCK) are expected at full resolution
+	for _, component := range i.Components[3:] {
+		if component.HorizontalSampling != luma.HorizontalSampling || component.VerticalSampling != luma.VerticalSampling {
+			return ""
+		}
+	}
+
+	type ratio struct{ h, v uint8 }
+	switch (ratio{luma.HorizontalSampling / cb.HorizontalSampling, luma.VerticalSampling / cb.VerticalSampling}) {
+	case ratio{1, 1}:
+		return "4:4:4"
+	case ratio{2, 1}:
+		return "4:2:2"
+	case ratio{2, 2}:
+		return "4:2:0"
+	case ratio{1, 2}:
+		return "4:4:0"
+	case ratio{4, 1}:
+		return "4:1:1"
+	case ratio{4, 2}:
+		return "4:1:0"
+	default:
+		return ""
+	}
+}
 
 func (e JPEG) BufSize() int {
 	return len(jpegHeader)
@@ -35,74 +316,592 @@ func (e JPEG) MatchFormat(buf []byte) (string, bool) {
 }
 
 func (e JPEG) ExtractSize(reader io.ReadSeeker) (width, height int, err error) {
-	if _, err = reader.Seek(2, io.SeekStart); err != nil {
-		err = fmt.Errorf("failed to seek to position: %w", err)
+	info, err := e.ExtractInfo(reader)
+	if err != nil {
 		return
 	}
 
-	var seg [1]byte
-	if seg, err = e.readSegment(reader); err != nil {
+	return info.Width, info.Height, nil
+}
+
+// ExtractDetails implements imagesize.DetailsExtractor, the details are of type *JPEGInfo.
+func (e JPEG) ExtractDetails(reader io.ReadSeeker) (width, height int, details interface{}, err error) {
+	info, err := e.ExtractInfo(reader)
+	if err != nil {
 		return
 	}
 
-	// Read untill Start of Scan marker or end of file
-	for seg[0] != 0xDA && seg[0] != 0 {
-		// Read until 0xFF (Start of Segment)
-		for seg[0] != 0xFF {
-			if seg, err = e.readSegment(reader); err != nil {
-				return
+	return info.Width, info.Height, info, nil
+}
+
+// ExtractInfo walks the segments of the file until the Start of Frame segment,
+// which holds the size of the image and determines its coding process.
+func (e JPEG) ExtractInfo(reader io.ReadSeeker) (*JPEGInfo, error) {
+	if _, err := reader.Seek(2, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to position: %w", err)
+	}
+
+	info := new(JPEGInfo)
+	frame := false
+	var hierarchicalWidth, hierarchicalHeight int
+	hierarchical := false
+	for {
+		marker, err := e.readMarker(reader)
+		if err != nil {
+			// Tables that follow the frame header are optional
+			if frame && isEOF(err) {
+				info.Truncated = e.CountScans
+				break
+			}
+			return nil, err
+		}
+
+		// Start of Scan is followed by entropy-coded data, End of Image ends the file
+		if marker == jpegMarkerSOS || marker == jpegMarkerEOI {
+			if !frame {
+				return nil, errors.New("failed to read image size, stop marker was reached")
+			}
+
+			if marker == jpegMarkerSOS && e.CountScans {
+				if err := e.readScans(reader, info); err != nil {
+					return nil, err
+				}
 			}
+			break
 		}
 
-		// Skip past all 0xFF bytes
-		for seg[0] == 0xFF {
-			if seg, err = e.readSegment(reader); err != nil {
-				return
+		// Markers without a segment
+		if isJPEGStandaloneMarker(marker) {
+			continue
+		}
+
+		length, err := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+		if err != nil {
+			if frame && isEOF(err) {
+				info.Truncated = e.CountScans
+				break
 			}
+			return nil, fmt.Errorf("failed to read segment length: %w", err)
+		}
+
+		// Length includes its own 2 bytes
+		if length < 2 {
+			return nil, errors.New("corrupted image: invalid segment length")
 		}
 
-		// Check for specific markers (0xC0 to 0xC3 - Start of Frame, contains image size data)
-		if seg[0] >= 0xC0 && seg[0] <= 0xC3 {
-			_, err = reader.Seek(3, io.SeekCurrent)
+		if isJPEGSOFMarker(marker) && !frame {
+			headerSize, err := e.readStartOfFrame(reader, marker, info)
 			if err != nil {
-				return
+				return nil, err
 			}
+			frame = true
 
-			heightU16, heightErr := imagebytes.ReadU16(reader, imagebytes.BigEndian)
-			widthU16, widthErr := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+			if hierarchical {
+				info.Width, info.Height = hierarchicalWidth, hierarchicalHeight
+				info.Hierarchical = true
+			}
 
-			if sizeErr := imagerrors.Join(widthErr, heightErr); sizeErr != nil {
-				err = fmt.Errorf("failed to read image size: %w", sizeErr)
-				return
+			// Quantization tables may also be defined between the frame header and the first scan
+			if !e.EstimateQuality && !e.CountScans {
+				break
 			}
 
-			return int(widthU16), int(heightU16), nil
+			if int(length)-2 > headerSize {
+				if _, err := reader.Seek(int64(int(length)-2-headerSize), io.SeekCurrent); err != nil {
+					return nil, fmt.Errorf("failed to seek to the next segment: %w", err)
+				}
+			}
+			continue
+		}
+
+		// Define Hierarchical Progression precedes the frames of hierarchical images, with the same layout
+		// as a frame header: sample precision (1), height and width (2 each), then the components
+		if marker == jpegMarkerDHP && !frame && length >= 7 {
+			var header [5]byte
+			if _, err := io.ReadFull(reader, header[:]); err != nil {
+				return nil, fmt.Errorf("failed to read hierarchical progression: %w", err)
+			}
+
+			hierarchical = true
+			hierarchicalHeight = int(binary.BigEndian.Uint16(header[1:3]))
+			hierarchicalWidth = int(binary.BigEndian.Uint16(header[3:5]))
+			if _, err := reader.Seek(int64(length)-2-int64(len(header)), io.SeekCurrent); err != nil {
+				return nil, fmt.Errorf("failed to seek to the next segment: %w", err)
+			}
+			continue
+		}
+
+		// JFIF, EXIF, MPF and Adobe segments precede the frame header, so they are read on the way
+		isAPP := marker == jpegMarkerAPP0 || marker == jpegMarkerAPP1 || marker == jpegMarkerAPP2 || marker == jpegMarkerAPP14
+		if isAPP || (marker == jpegMarkerDQT && e.EstimateQuality) {
+			offset, err := reader.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get segment offset: %w", err)
+			}
+
+			// APP1 and APP2 segments are only read for the identifiers that are needed,
+			// ICC profiles and XMP packets being read on request
+			size := int(length) - 2
+			var identifier [jpegIdentifierSize]byte
+			prefix := identifier[:0]
+			if marker == jpegMarkerAPP1 || marker == jpegMarkerAPP2 {
+				if prefix = identifier[:]; size < len(prefix) {
+					prefix = identifier[:size]
+				}
+				if _, err := io.ReadFull(reader, prefix); err != nil {
+					return nil, fmt.Errorf("failed to read APP%d segment: %w", marker&0x0F, err)
+				}
+
+				if !e.wantsSegment(marker, prefix, offset, size, info) {
+					if _, err := reader.Seek(int64(size-len(prefix)), io.SeekCurrent); err != nil {
+						return nil, fmt.Errorf("failed to seek to the next segment: %w", err)
+					}
+					continue
+				}
+			}
+
+			payload := make([]byte, size)
+			copy(payload, prefix)
+			if _, err := io.ReadFull(reader, payload[len(prefix):]); err != nil {
+				if marker == jpegMarkerDQT {
+					return nil, fmt.Errorf("failed to read quantization tables: %w", err)
+				}
+				return nil, fmt.Errorf("failed to read APP%d segment: %w", marker&0x0F, err)
+			}
+
+			switch marker {
+			case jpegMarkerAPP0:
+				e.readAPP0(payload, info)
+			case jpegMarkerAPP1:
+				e.readAPP1(payload, offset, info)
+			case jpegMarkerAPP2:
+				e.readAPP2(payload, offset, info)
+			case jpegMarkerAPP14:
+				e.readAPP14(payload, info)
+			case jpegMarkerDQT:
+				if err := readQuantTables(payload, &info.quantTables); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if _, err := reader.Seek(int64(length)-2, io.SeekCurrent); err != nil {
+			return nil, fmt.Errorf("failed to seek to the next segment: %w", err)
+		}
+	}
+
+	// JFIF is preferred as it is rewritten by editors, which tend to copy EXIF data as is
+	exif := openEXIF(info.exif)
+	info.OrientedSize = orientedSize(exif, info.Width, info.Height)
+	info.Resolution = resolveResolution(info.OrientedSize, info.jfif, exifResolution(exif))
+	info.EmbeddedImages = e.embeddedImages(info, exif)
+	info.GainMap = e.gainMap(reader, info)
+
+	if e.ReadColorProfile {
+		info.ColorProfile = e.colorProfile(info.iccChunks)
+	}
+
+	if e.ReadXMP {
+		info.XMP = e.readXMP(info, exif)
+	}
+
+	if e.ReadEXIF && exif != nil {
+		info.EXIF = newEXIF(exif)
+	}
+
+	if e.ReadEmbeddedImages {
+		e.readEmbeddedImages(reader, info)
+	}
+	if gainMap := info.gainMapImage(); gainMap != nil {
+		if !e.ReadEmbeddedImages {
+			e.readEmbeddedImage(reader, info, gainMap)
+		}
+		info.GainMap.Width, info.GainMap.Height = gainMap.Width, gainMap.Height
+	}
+
+	if e.EstimateQuality {
+		info.Quality = estimateQuality(info)
+	}
+	return info, nil
+}
+
+// Reads the frame header that follows a Start of Frame marker: sample precision (1), height and width (2 each),
+// number of components (1) and, for each component, its identifier, sampling factors and quantization table (1 each).
+// Returns the number of bytes read.
+func (e JPEG) readStartOfFrame(reader io.Reader, marker byte, info *JPEGInfo) (int, error) {
+	precision, err := imagebytes.ReadU8(reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read image size: %w", err)
+	}
+
+	heightU16, heightErr := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+	widthU16, widthErr := imagebytes.ReadU16(reader, imagebytes.BigEndian)
+	if sizeErr := imagerrors.Join(widthErr, heightErr); sizeErr != nil {
+		return 0, fmt.Errorf("failed to read image size: %w", sizeErr)
+	}
+
+	info.Width, info.Height = int(widthU16), int(heightU16)
+	info.Precision = precision
+	info.SOFMarker = marker
+	info.Process = JPEGProcess(marker & 0x03)
+	info.Arithmetic = marker&0x08 != 0
+	info.Hierarchical = marker&0x04 != 0
+	info.Progressive = info.Process == JPEGProgressive
+
+	count, err := imagebytes.ReadU8(reader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read number of components: %w", err)
+	}
+
+	components := make([]byte, 3*int(count))
+	if _, err := io.ReadFull(reader, components); err != nil {
+		return 0, fmt.Errorf("failed to read components: %w", err)
+	}
+
+	info.Components = make([]JPEGComponent, count)
+	for i := range info.Components {
+		info.Components[i] = JPEGComponent{
+			ID:                 components[3*i],
+			HorizontalSampling: components[3*i+1] >> 4,
+			VerticalSampling:   components[3*i+1] & 0x0F,
+			QuantizationTable:  components[3*i+2],
+		}
+	}
+
+	info.ColorSpace = e.colorSpace(info)
+	return 6 + len(components), nil
+}
+
+// Counts the scans from the first Start of Scan marker, which was just read, to the End of Image marker.
+func (e JPEG) readScans(reader io.Reader, info *JPEGInfo) error {
+	buffered := bufio.NewReader(reader)
+
+	marker := byte(jpegMarkerSOS)
+	for marker != jpegMarkerEOI {
+		var err error
+		if !isJPEGStandaloneMarker(marker) {
+			var length uint16
+			if length, err = imagebytes.ReadU16(buffered, imagebytes.BigEndian); err == nil && length < 2 {
+				return errors.New("corrupted image: invalid segment length")
+			}
+			if err == nil {
+				_, err = buffered.Discard(int(length) - 2)
+			}
+		}
+
+		if err == nil {
+			if marker == jpegMarkerSOS {
+				info.Scans++
+				marker, err = e.skipEntropyCodedData(buffered)
+			} else {
+				marker, err = e.readMarker(buffered)
+			}
 		}
 
-		offset, offsetErr := imagebytes.ReadU16(reader, imagebytes.BigEndian)
 		if err != nil {
-			err = fmt.Errorf("failed to read offset: %w", offsetErr)
-			return
+			if isEOF(err) {
+				info.Truncated = true
+				return nil
+			}
+			return fmt.Errorf("failed to read scans: %w", err)
 		}
+	}
+	return nil
+}
 
-		if _, err = reader.Seek(int64(offset-2), io.SeekCurrent); err != nil {
-			err = fmt.Errorf("failed to seek to the next segment: %w", err)
-			return
+// Skips the entropy-coded data of a scan, in which 0xFF bytes are followed by 0x00 (stuffing)
+// or by a restart marker (RSTn), and returns the marker that ends it.
+func (e JPEG) skipEntropyCodedData(reader *bufio.Reader) (byte, error) {
+	for {
+		if _, err := reader.ReadSlice(0xFF); err != nil {
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			return 0, err
+		}
+
+		// Skip past all 0xFF fill bytes
+		b, err := reader.ReadByte()
+		for err == nil && b == 0xFF {
+			b, err = reader.ReadByte()
 		}
+		if err != nil {
+			return 0, err
+		}
+
+		if b != 0x00 && !isJPEGRestartMarker(b) {
+			return b, nil
+		}
+	}
+}
+
+// Determines the color space the way libjpeg does, see jdapimin.c.
+func (e JPEG) colorSpace(info *JPEGInfo) JPEGColorSpace {
+	switch len(info.Components) {
+	case 1:
+		return JPEGColorSpaceGrayscale
+	case 3:
+		if info.hasJFIF {
+			return JPEGColorSpaceYCbCr
+		}
+		if info.Adobe {
+			if info.AdobeTransform == adobeTransformNone {
+				return JPEGColorSpaceRGB
+			}
+			return JPEGColorSpaceYCbCr
+		}
+
+		// Components named after their color
+		if ids := info.Components; ids[0].ID == 'R' && ids[1].ID == 'G' && ids[2].ID == 'B' {
+			return JPEGColorSpaceRGB
+		}
+		return JPEGColorSpaceYCbCr
+	case 4:
+		if info.Adobe && info.AdobeTransform == adobeTransformYCCK {
+			return JPEGColorSpaceYCCK
+		}
+		return JPEGColorSpaceCMYK
+	default:
+		return JPEGColorSpaceUnknown
+	}
+}
+
+// Reads the density of the JFIF APP0 segment: identifier (5), version (2), units (1),
+// horizontal and vertical densities (2 each). JFIF extension (JFXX) segments are ignored.
+func (e JPEG) readAPP0(payload []byte, info *JPEGInfo) {
+	if info.hasJFIF || len(payload) < 12 || !bytes.HasPrefix(payload, jfifHeader) {
+		return
+	}
+	info.hasJFIF = true
+
+	// Units: 0 for the pixel aspect ratio only, 1 for dots per inch, 2 for dots per centimeter
+	unit := densityAspectOnly
+	switch payload[7] {
+	case 1:
+		unit = densityPerInch
+	case 2:
+		unit = densityPerCentimeter
+	}
+
+	x := float64(binary.BigEndian.Uint16(payload[8:10]))
+	y := float64(binary.BigEndian.Uint16(payload[10:12]))
+	info.jfif = newResolution(ResolutionJFIF, x, y, unit)
+}
+
+// Reads the transform flag of the Adobe APP14 segment: identifier (5), version (2), flags (2 each) and transform (1).
+func (e JPEG) readAPP14(payload []byte, info *JPEGInfo) {
+	if info.Adobe || len(payload) < 12 || !bytes.HasPrefix(payload, adobeHeader) {
+		return
+	}
+
+	info.Adobe = true
+	info.AdobeTransform = payload[11]
+}
+
+// Keeps the EXIF data and the XMP packet of the first APP1 segments that carry them.
+func (e JPEG) readAPP1(payload []byte, offset int64, info *JPEGInfo) {
+	switch {
+	case info.exif == nil && bytes.HasPrefix(payload, exifHeader):
+		info.exif = payload[len(exifHeader):]
+		info.exifOffset = offset + int64(len(exifHeader))
+	case info.xmp == nil && bytes.HasPrefix(payload, xmpHeader):
+		info.xmp = payload[len(xmpHeader):]
+	case e.ReadXMP && bytes.HasPrefix(payload, xmpExtensionHeader):
+		e.readXMPExtension(payload[len(xmpExtensionHeader):], info)
+	}
+}
+
+// Tells whether an APP1 or APP2 segment starting with the given identifier has to be read.
+// The location of an XMP packet that is not read is kept, as gain map detection may need it.
+func (e JPEG) wantsSegment(marker byte, identifier []byte, offset int64, size int, info *JPEGInfo) bool {
+	if e.embedded {
+		return false
+	}
 
-		if seg, err = e.readSegment(reader); err != nil {
+	if marker == jpegMarkerAPP2 {
+		switch {
+		case bytes.HasPrefix(identifier, mpfHeader):
+			return info.mpf == nil
+		case bytes.HasPrefix(identifier, iccProfileHeader):
+			return e.ReadColorProfile
+		}
+		return false
+	}
+
+	switch {
+	case bytes.HasPrefix(identifier, exifHeader):
+		return info.exif == nil
+	case bytes.HasPrefix(identifier, xmpHeader):
+		if !e.ReadXMP && info.xmpSize == 0 {
+			info.xmpOffset, info.xmpSize = offset+int64(len(xmpHeader)), size-len(xmpHeader)
+		}
+		return e.ReadXMP && info.xmp == nil
+	case bytes.HasPrefix(identifier, xmpExtensionHeader):
+		return e.ReadXMP
+	}
+	return false
+}
+
+// Keeps the MP Index IFD of the first APP2 segment that carries it and the chunks of the ICC profile.
+func (e JPEG) readAPP2(payload []byte, offset int64, info *JPEGInfo) {
+	switch {
+	case info.mpf == nil && bytes.HasPrefix(payload, mpfHeader):
+		info.mpf = payload[len(mpfHeader):]
+		info.mpfOffset = offset + int64(len(mpfHeader))
+	case e.ReadColorProfile && len(payload) >= len(iccProfileHeader)+2 && bytes.HasPrefix(payload, iccProfileHeader):
+		// Sequence number starting at 1 (1) and number of chunks (1)
+		sequence, count := int(payload[len(iccProfileHeader)]), int(payload[len(iccProfileHeader)+1])
+		if info.iccChunks == nil {
+			info.iccChunks = make([][]byte, count)
+		}
+
+		if count == len(info.iccChunks) && sequence >= 1 && sequence <= count && info.iccChunks[sequence-1] == nil {
+			info.iccChunks[sequence-1] = payload[len(iccProfileHeader)+2:]
+		}
+	}
+}
+
+// Reassembles the ICC profile from its chunks.
+func (e JPEG) colorProfile(chunks [][]byte) *ColorProfile {
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	size := 0
+	for _, chunk := range chunks {
+		if chunk == nil {
+			return nil
+		}
+		size += len(chunk)
+	}
+	if size > maxICCSize {
+		return nil
+	}
+
+	icc := make([]byte, 0, size)
+	for _, chunk := range chunks {
+		icc = append(icc, chunk...)
+	}
+	return newICCColorProfile(icc)
+}
+
+// jpegXMPExtension is an Extended XMP being reassembled from its APP1 segments.
+type jpegXMPExtension struct {
+	data []byte
+
+	// Size of the segments received so far by offset, segments may come in any order.
+	segments map[uint32]int
+}
+
+// Reports whether the segments received so far cover the whole extension.
+func (x *jpegXMPExtension) complete() bool {
+	offsets := make([]uint32, 0, len(x.segments))
+	for offset := range x.segments {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	covered := 0
+	for _, offset := range offsets {
+		if int(offset) > covered {
+			return false
+		}
+		if end := int(offset) + x.segments[offset]; end > covered {
+			covered = end
+		}
+	}
+	return covered == len(x.data)
+}
+
+// Reads an Extended XMP segment: GUID of the extension as 32 hexadecimal digits, full length (4),
+// offset of the segment in the extension (4) and data.
+func (e JPEG) readXMPExtension(payload []byte, info *JPEGInfo) {
+	if len(payload) < 40 {
+		return
+	}
+
+	guid := string(payload[:32])
+	length, offset := binary.BigEndian.Uint32(payload[32:36]), binary.BigEndian.Uint32(payload[36:40])
+	data := payload[40:]
+
+	extension, ok := info.xmpExtensions[guid]
+	if !ok {
+		if length > maxXMPSize {
 			return
 		}
+		if info.xmpExtensions == nil {
+			info.xmpExtensions = make(map[string]*jpegXMPExtension)
+		}
+
+		extension = &jpegXMPExtension{data: make([]byte, length), segments: make(map[uint32]int)}
+		info.xmpExtensions[guid] = extension
 	}
 
-	err = errors.New("failed to read image size, stop marker was reached")
-	return
+	if uint64(length) != uint64(len(extension.data)) || uint64(offset)+uint64(len(data)) > uint64(length) {
+		return
+	}
+	extension.segments[offset] = copy(extension.data[offset:], data)
 }
 
-// More readable, go compiler should inline this, so no performance loss
-func (e JPEG) readSegment(reader io.ReadSeeker) (seg [1]byte, err error) {
-	if _, err = reader.Read(seg[:]); err != nil {
-		err = fmt.Errorf("failed to read segment: %w", err)
+// Builds the XMP of the APP1 segments, or else of the EXIF data, along with the Extended XMP
+// the packet refers to. Extended XMP missing some of its segments is left out.
+func (e JPEG) readXMP(info *JPEGInfo, exif *tiffData) *XMP {
+	packet := info.xmp
+	if packet == nil && exif != nil {
+		packet = exif.xmp()
+	}
+	if packet == nil {
+		return nil
+	}
+
+	xmp := newXMP(packet)
+	extension, ok := info.xmpExtensions[xmp.Properties["xmpNote:HasExtendedXMP"]]
+	if ok && extension.complete() {
+		xmp.Extended = extension.data
+		readXMPProperties(extension.data, xmp.Properties)
 	}
-	return
+	return xmp
+}
+
+// Reads the next marker, skipping any bytes before the 0xFF prefix and fill bytes.
+func (e JPEG) readMarker(reader io.Reader) (byte, error) {
+	for {
+		b, err := imagebytes.ReadU8(reader)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read segment: %w", err)
+		}
+
+		// Read until 0xFF (Start of Segment)
+		if b != 0xFF {
+			continue
+		}
+
+		// Skip past all 0xFF fill bytes
+		for b == 0xFF {
+			if b, err = imagebytes.ReadU8(reader); err != nil {
+				return 0, fmt.Errorf("failed to read segment: %w", err)
+			}
+		}
+
+		// 0xFF00 is a stuffed data byte, not a marker
+		if b != 0x00 {
+			return b, nil
+		}
+	}
+}
+
+// Start of Frame markers are 0xC0-0xCF, except DHT (0xC4), JPG (0xC8) and DAC (0xCC).
+func isJPEGSOFMarker(marker byte) bool {
+	return marker&0xF0 == 0xC0 && marker != jpegMarkerDHT && marker != jpegMarkerJPG && marker != jpegMarkerDAC
+}
+
+// RSTn (0xD0-0xD7) markers separate the intervals of entropy-coded data.
+func isJPEGRestartMarker(marker byte) bool {
+	return marker >= 0xD0 && marker <= 0xD7
+}
+
+// TEM (0x01), RSTn (0xD0-0xD7), SOI (0xD8) and EOI (0xD9) have no length nor payload.
+func isJPEGStandaloneMarker(marker byte) bool {
+	return marker == 0x01 || (marker >= 0xD0 && marker <= 0xD9)
 }
@@ -0,0 +1,279 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+var (
+	mpfHeader = []byte("MPF\x00")
+	xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+	// Namespace of the XMP metadata of Ultra HDR gain maps.
+	hdrgmNamespace = []byte("http://ns.adobe.com/hdr-gain-map/1.0/")
+)
+
+// Tags of the MP Index IFD.
+// See CIPA DC-007 "Multi-Picture Format".
+const (
+	mpTagNumberOfImages = 0xB001
+	mpTagEntry          = 0xB002
+)
+
+// Size of an MP Entry: individual image attribute (4), size (4), data offset (4) and dependent images (2 each).
+const mpEntrySize = 16
+
+// MP type codes, the low 24 bits of the individual image attribute.
+const (
+	mpTypeLargeThumbnailVGA    = 0x010001
+	mpTypeLargeThumbnailFullHD = 0x010002
+	mpTypePanorama             = 0x020001
+	mpTypeDisparity            = 0x020002
+	mpTypeMultiAngle           = 0x020003
+	mpTypePrimary              = 0x030000
+)
+
+// JPEGImageType describes an image embedded in a JPEG file.
+type JPEGImageType uint8
+
+const (
+	// JPEGImageUndefined is an MPF image without a specific type, e.g. a gain map.
+	JPEGImageUndefined JPEGImageType = iota
+
+	// JPEGImageThumbnail is the thumbnail of the EXIF data (IFD1).
+	JPEGImageThumbnail
+
+	// JPEGImagePrimary is the primary image of a multi-picture file, which is the JPEG file itself.
+	JPEGImagePrimary
+
+	// JPEGImageLargeThumbnail is a preview of the primary image, in VGA or full HD size.
+	JPEGImageLargeThumbnail
+
+	// JPEGImagePanorama is an image of a multi-frame panorama.
+	JPEGImagePanorama
+
+	// JPEGImageDisparity is a view of a stereoscopic image.
+	JPEGImageDisparity
+
+	// JPEGImageMultiAngle is a view of a multi-angle image.
+	JPEGImageMultiAngle
+
+	// JPEGImageGainMap is the gain map of an Ultra HDR image, an MPF image without a specific type.
+	JPEGImageGainMap
+)
+
+func (t JPEGImageType) String() string {
+	switch t {
+	case JPEGImageThumbnail:
+		return "Thumbnail"
+	case JPEGImagePrimary:
+		return "Primary"
+	case JPEGImageLargeThumbnail:
+		return "LargeThumbnail"
+	case JPEGImagePanorama:
+		return "Panorama"
+	case JPEGImageDisparity:
+		return "Disparity"
+	case JPEGImageMultiAngle:
+		return "MultiAngle"
+	case JPEGImageGainMap:
+		return "GainMap"
+	default:
+		return "Undefined"
+	}
+}
+
+// JPEGEmbeddedImage describes an image embedded in a JPEG file.
+type JPEGEmbeddedImage struct {
+	Type JPEGImageType
+
+	// Offset from the start of the file and length of the image data.
+	Offset int64
+	Length int64
+
+	// Dimensions read with JPEG.ReadEmbeddedImages, or for the gain map only without it,
+	// 0 otherwise or when the image cannot be read.
+	Width  int
+	Height int
+}
+
+// Format returns "mpo" for multi-picture files, whose MPF index lists more than one image,
+// and an empty string otherwise.
+func (i *JPEGInfo) Format() string {
+	images := 0
+	for _, image := range i.EmbeddedImages {
+		if image.Type != JPEGImageThumbnail {
+			images++
+		}
+	}
+
+	if images > 1 {
+		return "mpo"
+	}
+	return ""
+}
+
+// Lists the EXIF thumbnail and the images of the MPF index.
+func (e JPEG) embeddedImages(info *JPEGInfo, exif *tiffData) []JPEGEmbeddedImage {
+	var images []JPEGEmbeddedImage
+	if exif != nil {
+		if offset, length, ok := exif.thumbnail(); ok {
+			images = append(images, JPEGEmbeddedImage{
+				Type:   JPEGImageThumbnail,
+				Offset: info.exifOffset + int64(offset),
+				Length: int64(length),
+			})
+		}
+	}
+
+	mpf, err := newTIFFData(info.mpf)
+	if err != nil {
+		return images
+	}
+
+	entries, _, err := mpf.readIFD(mpf.firstIFD())
+	if err != nil {
+		return images
+	}
+
+	entry, ok := findTIFFEntry(entries, mpTagEntry)
+	if !ok || entry.typ != tiffTypeUndefined {
+		return images
+	}
+
+	count := len(entry.value) / mpEntrySize
+	if numberEntry, ok := findTIFFEntry(entries, mpTagNumberOfImages); ok {
+		if number, ok := mpf.uintValue(numberEntry); ok && int(number) < count {
+			count = int(number)
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		raw := entry.value[i*mpEntrySize : (i+1)*mpEntrySize]
+		attribute := mpf.order.Uint32(raw[0:4])
+
+		image := JPEGEmbeddedImage{
+			Type:   mpImageType(attribute),
+			Length: int64(mpf.order.Uint32(raw[4:8])),
+		}
+
+		// The offset of the first image is 0, others are relative to the MP header
+		if offset := mpf.order.Uint32(raw[8:12]); offset != 0 {
+			image.Offset = info.mpfOffset + int64(offset)
+		}
+
+		images = append(images, image)
+	}
+	return images
+}
+
+func mpImageType(attribute uint32) JPEGImageType {
+	switch attribute & 0x00FFFFFF {
+	case mpTypePrimary:
+		return JPEGImagePrimary
+	case mpTypeLargeThumbnailVGA, mpTypeLargeThumbnailFullHD:
+		return JPEGImageLargeThumbnail
+	case mpTypePanorama:
+		return JPEGImagePanorama
+	case mpTypeDisparity:
+		return JPEGImageDisparity
+	case mpTypeMultiAngle:
+		return JPEGImageMultiAngle
+	default:
+		return JPEGImageUndefined
+	}
+}
+
+// HDRGainMap implements imagesize.GainMapDetails.
+func (i *JPEGInfo) HDRGainMap() *GainMap {
+	return i.GainMap
+}
+
+// Returns the embedded image holding the gain map, if any.
+func (i *JPEGInfo) gainMapImage() *JPEGEmbeddedImage {
+	for j := range i.EmbeddedImages {
+		if i.EmbeddedImages[j].Type == JPEGImageGainMap {
+			return &i.EmbeddedImages[j]
+		}
+	}
+	return nil
+}
+
+// Detects the gain map of Ultra HDR files: the primary image has XMP metadata in the hdrgm namespace
+// and the gain map is the first secondary image without a specific type in the MPF index.
+// The XMP packet is only read here if there is such an image and it was not read with JPEG.ReadXMP.
+func (e JPEG) gainMap(reader io.ReadSeeker, info *JPEGInfo) *GainMap {
+	var candidate *JPEGEmbeddedImage
+	for i := range info.EmbeddedImages {
+		if image := &info.EmbeddedImages[i]; image.Type == JPEGImageUndefined && image.Offset != 0 {
+			candidate = image
+			break
+		}
+	}
+	if candidate == nil {
+		return nil
+	}
+
+	xmp := info.xmp
+	if xmp == nil && info.xmpSize > 0 {
+		xmp = make([]byte, info.xmpSize)
+		if _, err := reader.Seek(info.xmpOffset, io.SeekStart); err != nil {
+			return nil
+		}
+		if _, err := io.ReadFull(reader, xmp); err != nil {
+			return nil
+		}
+	}
+
+	if !bytes.Contains(xmp, hdrgmNamespace) {
+		return nil
+	}
+	candidate.Type = JPEGImageGainMap
+	return &GainMap{Source: GainMapUltraHDR}
+}
+
+// Reads the dimensions of the embedded images, ignoring those that cannot be read.
+func (e JPEG) readEmbeddedImages(reader io.ReadSeeker, info *JPEGInfo) {
+	for i := range info.EmbeddedImages {
+		e.readEmbeddedImage(reader, info, &info.EmbeddedImages[i])
+	}
+}
+
+// Reads the dimensions of an embedded image, leaving them at 0 when it cannot be read.
+// Only its frame header is read: its MPF index is not followed, so nested images are never read.
+func (e JPEG) readEmbeddedImage(reader io.ReadSeeker, info *JPEGInfo, image *JPEGEmbeddedImage) {
+	// The image at the start of the file is the one being read
+	if image.Offset == 0 {
+		image.Width, image.Height = info.Width, info.Height
+		return
+	}
+
+	readerAt, ok := reader.(io.ReaderAt)
+	if !ok {
+		readerAt = seekingReaderAt{reader}
+	}
+
+	embedded, err := JPEG{embedded: true}.ExtractInfo(io.NewSectionReader(readerAt, image.Offset, image.Length))
+	if err != nil {
+		return
+	}
+	image.Width, image.Height = embedded.Width, embedded.Height
+}
+
+// seekingReaderAt implements io.ReaderAt for readers that can only seek.
+type seekingReaderAt struct {
+	io.ReadSeeker
+}
+
+func (r seekingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(r.ReadSeeker, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,152 @@
+package extractor
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// jpegQuantTable is a quantization table in natural (row-major) order.
+type jpegQuantTable struct {
+	values [64]uint16
+
+	// Tables with 16-bit values are not limited to 255, unlike baseline tables.
+	extended bool
+}
+
+// Position in natural order of the coefficients, which tables list in zigzag order.
+var jpegNaturalOrder = [64]uint8{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// Standard tables of the JPEG specification (Annex K) that libjpeg scales by quality, in natural order.
+var (
+	jpegStdLuminanceTable = [64]uint16{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	}
+	jpegStdChrominanceTable = [64]uint16{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	}
+)
+
+// Reads the tables of a DQT segment. Each table starts with its precision (0 for 8-bit, 1 for 16-bit values)
+// and destination in the high and low nibbles of a byte, followed by 64 values in zigzag order.
+func readQuantTables(payload []byte, tables *[4]*jpegQuantTable) error {
+	for len(payload) > 0 {
+		precision, destination := payload[0]>>4, payload[0]&0x0F
+		if precision > 1 || destination > 3 {
+			return errors.New("corrupted image: invalid quantization table")
+		}
+
+		size := 64 * (int(precision) + 1)
+		if len(payload) < 1+size {
+			return errors.New("corrupted image: truncated quantization table")
+		}
+
+		table := &jpegQuantTable{extended: precision == 1}
+		for i, position := range jpegNaturalOrder {
+			if table.extended {
+				table.values[position] = binary.BigEndian.Uint16(payload[1+2*i:])
+			} else {
+				table.values[position] = uint16(payload[1+i])
+			}
+		}
+
+		tables[destination] = table
+		payload = payload[1+size:]
+	}
+	return nil
+}
+
+// Finds the quality whose scaled standard tables differ the least from the tables
+// used by the luma and chroma components, or 0 without tables.
+func estimateQuality(info *JPEGInfo) int {
+	lumaDestination, chromaDestination := uint8(0), uint8(1)
+	if len(info.Components) > 0 {
+		lumaDestination = info.Components[0].QuantizationTable
+	}
+	if len(info.Components) > 1 {
+		chromaDestination = info.Components[1].QuantizationTable
+	}
+
+	luma := quantTable(&info.quantTables, lumaDestination)
+	if luma == nil {
+		return 0
+	}
+
+	// Grayscale images and images sharing a single table are only compared against the luminance table
+	var chroma *jpegQuantTable
+	if len(info.Components) != 1 && chromaDestination != lumaDestination {
+		chroma = quantTable(&info.quantTables, chromaDestination)
+	}
+
+	best, bestDistance := 0, -1
+	for quality := 1; quality <= 100; quality++ {
+		distance := quantTableDistance(luma, &jpegStdLuminanceTable, quality)
+		if chroma != nil {
+			distance += quantTableDistance(chroma, &jpegStdChrominanceTable, quality)
+		}
+
+		if bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = quality, distance
+		}
+	}
+	return best
+}
+
+func quantTable(tables *[4]*jpegQuantTable, destination uint8) *jpegQuantTable {
+	if int(destination) >= len(tables) {
+		return nil
+	}
+	return tables[destination]
+}
+
+// Sums the differences between a table and a standard table scaled the way libjpeg does, see jcparam.c.
+func quantTableDistance(table *jpegQuantTable, standard *[64]uint16, quality int) int {
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+
+	maxValue := 255
+	if table.extended {
+		maxValue = 32767
+	}
+
+	distance := 0
+	for i, base := range standard {
+		expected := (int(base)*scale + 50) / 100
+		if expected < 1 {
+			expected = 1
+		} else if expected > maxValue {
+			expected = maxValue
+		}
+
+		diff := int(table.values[i]) - expected
+		if diff < 0 {
+			diff = -diff
+		}
+		distance += diff
+	}
+	return distance
+}
@@ -2,14 +2,37 @@ package extractor_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"image"
+	stdjpeg "image/jpeg"
+	"math"
+	"os"
 	"testing"
 
 	"github.com/pillowskiy/imagesize/extractor"
 )
 
+// APP2 segment with an MPF index of images given by their attribute, size and offset.
+func mpfSegment(images ...[3]uint32) []byte {
+	order := binary.BigEndian
+
+	var entries []byte
+	for _, image := range images {
+		entries = mergeBuffers(entries, be32(image[0]), be32(image[1]), be32(image[2]), be32(0))
+	}
+
+	index := tiffBlock(order, []tiffTestEntry{
+		{tag: 0xB001, typ: 4, count: 1, value: be32(uint32(len(images)))},
+		{tag: 0xB002, typ: 7, count: uint32(len(entries)), value: entries},
+	})
+
+	payload := mergeBuffers([]byte("MPF\x00"), index)
+	return mergeBuffers([]byte{0xFF, 0xE2}, be16(uint16(2+len(payload))), payload)
+}
+
 func TestJPEG(t *testing.T) {
 	t.Parallel()
-	extractor := extractor.JPEG{}
+	jpeg := extractor.JPEG{}
 
 	jpegMinimalHeader := []byte{0xFF, 0xD8, 0xFF} // SOI
 	jpegHeader := append(jpegMinimalHeader, 0xE0) // APP0 header
@@ -40,7 +63,7 @@ func TestJPEG(t *testing.T) {
 	)
 
 	t.Run("BufferSizeMatchesJPEGHeaderLength", func(t *testing.T) {
-		bufSize := extractor.BufSize()
+		bufSize := jpeg.BufSize()
 		expectedBufSize := len(jpegMinimalHeader)
 
 		if bufSize != expectedBufSize {
@@ -49,7 +72,7 @@ func TestJPEG(t *testing.T) {
 	})
 
 	t.Run("FormatDetection", func(t *testing.T) {
-		format, matched := extractor.MatchFormat(validJPEG)
+		format, matched := jpeg.MatchFormat(validJPEG)
 		if !matched {
 			t.Error("expected match for valid JPEG file")
 		}
@@ -62,7 +85,7 @@ func TestJPEG(t *testing.T) {
 
 	t.Run("ExtractSizeFromValidImage", func(t *testing.T) {
 		reader := bytes.NewReader(validJPEG)
-		width, height, err := extractor.ExtractSize(reader)
+		width, height, err := jpeg.ExtractSize(reader)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -76,6 +99,796 @@ func TestJPEG(t *testing.T) {
 		}
 	})
 
+	t.Run("ExtractSizeFromAllSOFMarkers", func(t *testing.T) {
+		tests := []struct {
+			marker       byte
+			process      extractor.JPEGProcess
+			arithmetic   bool
+			hierarchical bool
+		}{
+			{0xC0, extractor.JPEGBaseline, false, false},
+			{0xC1, extractor.JPEGExtended, false, false},
+			{0xC2, extractor.JPEGProgressive, false, false},
+			{0xC3, extractor.JPEGLossless, false, false},
+			{0xC5, extractor.JPEGExtended, false, true},
+			{0xC6, extractor.JPEGProgressive, false, true},
+			{0xC7, extractor.JPEGLossless, false, true},
+			{0xC9, extractor.JPEGExtended, true, false},
+			{0xCA, extractor.JPEGProgressive, true, false},
+			{0xCB, extractor.JPEGLossless, true, false},
+			{0xCD, extractor.JPEGExtended, true, true},
+			{0xCE, extractor.JPEGProgressive, true, true},
+			{0xCF, extractor.JPEGLossless, true, true},
+		}
+
+		for _, tt := range tests {
+			buf := mergeBuffers(
+				jpegMinimalHeader[:2],
+				[]byte{0xFF, tt.marker, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00},
+				[]byte{0xFF, 0xDA},
+			)
+
+			info, err := jpeg.ExtractInfo(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatalf("SOF 0x%X: expected no error, got %v", tt.marker, err)
+			}
+
+			if info.Width != 1 || info.Height != 2 {
+				t.Errorf("SOF 0x%X: expected size 1x2, got %dx%d", tt.marker, info.Width, info.Height)
+			}
+
+			if info.SOFMarker != tt.marker || info.Process != tt.process ||
+				info.Arithmetic != tt.arithmetic || info.Hierarchical != tt.hierarchical {
+				t.Errorf("SOF 0x%X: expected %s (arithmetic: %v, hierarchical: %v), got %+v",
+					tt.marker, tt.process, tt.arithmetic, tt.hierarchical, info)
+			}
+		}
+	})
+
+	t.Run("ExtractSizeFromDHP", func(t *testing.T) {
+		// DHP of a 16x8 image, whose first frame is reduced to 4x2
+		buf := mergeBuffers(
+			jpegMinimalHeader[:2],
+			[]byte{0xFF, 0xDE, 0x00, 0x0B, 0x08, 0x00, 0x08, 0x00, 0x10, 0x01, 0x01, 0x11, 0x00},
+			[]byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x04, 0x01, 0x01, 0x11, 0x00},
+			[]byte{0xFF, 0xDA},
+		)
+
+		info, err := jpeg.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Width != 16 || info.Height != 8 || !info.Hierarchical {
+			t.Errorf("expected hierarchical image of 16x8, got %dx%d (hierarchical: %v)", info.Width, info.Height, info.Hierarchical)
+		}
+
+		if info.SOFMarker != 0xC0 || info.Process != extractor.JPEGBaseline {
+			t.Errorf("expected baseline first frame, got %+v", info)
+		}
+	})
+
+	t.Run("SkipNonSOFMarkers", func(t *testing.T) {
+		// DHT, JPG and DAC share the SOF marker range but carry no frame header
+		for _, marker := range []byte{0xC4, 0xC8, 0xCC} {
+			buf := mergeBuffers(
+				jpegMinimalHeader[:2],
+				[]byte{0xFF, marker, 0x00, 0x07, 0x08, 0x00, 0x09, 0x00, 0x09},
+				[]byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00},
+				[]byte{0xFF, 0xDA},
+			)
+
+			width, height, err := jpeg.ExtractSize(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatalf("marker 0x%X: expected no error, got %v", marker, err)
+			}
+
+			if width != 1 || height != 2 {
+				t.Errorf("marker 0x%X: expected size 1x2, got %dx%d", marker, width, height)
+			}
+		}
+	})
+
+	t.Run("ExtractEXIFOrientation", func(t *testing.T) {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			exif := exifBlock(order, []tiffTestEntry{tiffShort(order, 0x0112, 6)})
+
+			buf := mergeBuffers(
+				jpegMinimalHeader[:2],
+				[]byte{0xFF, 0xE1}, be16(uint16(2+len(exif))), exif,
+				[]byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00},
+				[]byte{0xFF, 0xDA},
+			)
+
+			info, err := jpeg.ExtractInfo(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatalf("%v: expected no error, got %v", order, err)
+			}
+
+			if info.Orientation != extractor.OrientationRotate90 {
+				t.Errorf("%v: expected orientation 6, got %d", order, info.Orientation)
+			}
+
+			if info.Width != 1 || info.Height != 2 {
+				t.Errorf("%v: expected stored size 1x2, got %dx%d", order, info.Width, info.Height)
+			}
+
+			if info.DisplayWidth != 2 || info.DisplayHeight != 1 {
+				t.Errorf("%v: expected display size 2x1, got %dx%d", order, info.DisplayWidth, info.DisplayHeight)
+			}
+		}
+	})
+
+	t.Run("IgnoreMalformedEXIF", func(t *testing.T) {
+		exif := []byte("Exif\x00\x00MM\x00*\x00\x00\xFF\xFF")
+
+		buf := mergeBuffers(
+			jpegMinimalHeader[:2],
+			[]byte{0xFF, 0xE1}, be16(uint16(2+len(exif))), exif,
+			[]byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00},
+		)
+
+		info, err := jpeg.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Orientation != extractor.OrientationUnknown || info.DisplayWidth != 1 || info.DisplayHeight != 2 {
+			t.Errorf("expected unknown orientation and display size 1x2, got %+v", info)
+		}
+	})
+
+	t.Run("ExtractResolution", func(t *testing.T) {
+		jfif := func(unit byte, x, y uint16) []byte {
+			payload := mergeBuffers([]byte("JFIF\x00"), []byte{0x01, 0x02, unit}, be16(x), be16(y), []byte{0x00, 0x00})
+			return mergeBuffers([]byte{0xFF, 0xE0}, be16(uint16(2+len(payload))), payload)
+		}
+
+		exif := func(unit uint16, x, y uint32) []byte {
+			order := binary.BigEndian
+			block := exifBlock(order, []tiffTestEntry{
+				tiffRational(order, 0x011A, x, 1),
+				tiffRational(order, 0x011B, y, 1),
+				tiffShort(order, 0x0128, unit),
+			})
+			return mergeBuffers([]byte{0xFF, 0xE1}, be16(uint16(2+len(block))), block)
+		}
+
+		// 600x300 image
+		sof := []byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x01, 0x2C, 0x02, 0x58, 0x01, 0x01, 0x11, 0x00}
+
+		tests := []struct {
+			name       string
+			segments   [][]byte
+			source     extractor.ResolutionSource
+			xDPI, yDPI float64
+			conflict   bool
+		}{
+			{name: "None", source: extractor.ResolutionUnknown},
+			{name: "JFIF", segments: [][]byte{jfif(1, 300, 150)}, source: extractor.ResolutionJFIF, xDPI: 300, yDPI: 150},
+			{name: "EXIF", segments: [][]byte{exif(2, 300, 300)}, source: extractor.ResolutionEXIF, xDPI: 300, yDPI: 300},
+			{
+				name:     "JFIFAndEXIFConflict",
+				segments: [][]byte{jfif(1, 300, 300), exif(2, 72, 72)},
+				source:   extractor.ResolutionJFIF, xDPI: 300, yDPI: 300, conflict: true,
+			},
+			{
+				name:     "AspectOnlyJFIFAndEXIF",
+				segments: [][]byte{jfif(0, 1, 1), exif(3, 100, 100)},
+				source:   extractor.ResolutionEXIF, xDPI: 254, yDPI: 254,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				buf := mergeBuffers(jpegMinimalHeader[:2], mergeBuffers(tt.segments...), sof)
+
+				info, err := jpeg.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.ResolutionSource != tt.source || info.ResolutionConflict != tt.conflict {
+					t.Errorf("expected source %s with conflict %v, got %s with conflict %v",
+						tt.source, tt.conflict, info.ResolutionSource, info.ResolutionConflict)
+				}
+
+				if math.Abs(info.XDPI-tt.xDPI) > 1e-9 || math.Abs(info.YDPI-tt.yDPI) > 1e-9 {
+					t.Errorf("expected %vx%v DPI, got %vx%v", tt.xDPI, tt.yDPI, info.XDPI, info.YDPI)
+				}
+
+				if tt.xDPI > 0 && (math.Abs(info.WidthInches-600/tt.xDPI) > 1e-9 || math.Abs(info.HeightInches-300/tt.yDPI) > 1e-9) {
+					t.Errorf("expected %vx%v inches, got %vx%v", 600/tt.xDPI, 300/tt.yDPI, info.WidthInches, info.HeightInches)
+				}
+			})
+		}
+
+		t.Run("RotatedEXIF", func(t *testing.T) {
+			// 600x300 pixels of 300x100 DPI (2x3 inches), displayed as 300x600 pixels of 100x300 DPI
+			order := binary.BigEndian
+			block := exifBlock(order, []tiffTestEntry{
+				tiffShort(order, 0x0112, uint16(extractor.OrientationRotate90)),
+				tiffRational(order, 0x011A, 300, 1),
+				tiffRational(order, 0x011B, 100, 1),
+			})
+			buf := mergeBuffers(jpegMinimalHeader[:2], []byte{0xFF, 0xE1}, be16(uint16(2+len(block))), block, sof)
+
+			info, err := jpeg.ExtractInfo(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if info.DisplayWidth != 300 || info.DisplayHeight != 600 {
+				t.Errorf("expected display size 300x600, got %dx%d", info.DisplayWidth, info.DisplayHeight)
+			}
+
+			if math.Abs(info.WidthInches-3) > 1e-9 || math.Abs(info.HeightInches-2) > 1e-9 {
+				t.Errorf("expected 3x2 inches, got %vx%v", info.WidthInches, info.HeightInches)
+			}
+		})
+	})
+
+	t.Run("ExtractComponents", func(t *testing.T) {
+		sof := func(precision byte, components ...[3]byte) []byte {
+			header := []byte{precision, 0x00, 0x02, 0x00, 0x01, byte(len(components))}
+			for _, component := range components {
+				header = append(header, component[:]...)
+			}
+			return mergeBuffers([]byte{0xFF, 0xC0}, be16(uint16(2+len(header))), header)
+		}
+
+		adobe := func(transform byte) []byte {
+			payload := mergeBuffers([]byte("Adobe"), []byte{0x00, 0x64, 0x00, 0x00, 0x00, 0x00, transform})
+			return mergeBuffers([]byte{0xFF, 0xEE}, be16(uint16(2+len(payload))), payload)
+		}
+
+		jfif := mergeBuffers([]byte{0xFF, 0xE0, 0x00, 0x10}, []byte("JFIF\x00"), []byte{0x01, 0x02, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00})
+
+		tests := []struct {
+			name        string
+			segments    [][]byte
+			precision   uint8
+			colorSpace  extractor.JPEGColorSpace
+			subsampling string
+			transform   int
+		}{
+			{
+				name:       "Grayscale",
+				segments:   [][]byte{sof(8, [3]byte{1, 0x11, 0})},
+				precision:  8,
+				colorSpace: extractor.JPEGColorSpaceGrayscale,
+				transform:  -1,
+			},
+			{
+				name:        "YCbCr420",
+				segments:    [][]byte{jfif, sof(8, [3]byte{1, 0x22, 0}, [3]byte{2, 0x11, 1}, [3]byte{3, 0x11, 1})},
+				precision:   8,
+				colorSpace:  extractor.JPEGColorSpaceYCbCr,
+				subsampling: "4:2:0",
+				transform:   -1,
+			},
+			{
+				name:        "YCbCr422With12BitPrecision",
+				segments:    [][]byte{sof(12, [3]byte{1, 0x21, 0}, [3]byte{2, 0x11, 1}, [3]byte{3, 0x11, 1})},
+				precision:   12,
+				colorSpace:  extractor.JPEGColorSpaceYCbCr,
+				subsampling: "4:2:2",
+				transform:   -1,
+			},
+			{
+				name:        "RGBByComponentIDs",
+				segments:    [][]byte{sof(8, [3]byte{'R', 0x11, 0}, [3]byte{'G', 0x11, 0}, [3]byte{'B', 0x11, 0})},
+				precision:   8,
+				colorSpace:  extractor.JPEGColorSpaceRGB,
+				subsampling: "4:4:4",
+				transform:   -1,
+			},
+			{
+				name:        "AdobeRGB",
+				segments:    [][]byte{adobe(0), sof(8, [3]byte{1, 0x11, 0}, [3]byte{2, 0x11, 0}, [3]byte{3, 0x11, 0})},
+				precision:   8,
+				colorSpace:  extractor.JPEGColorSpaceRGB,
+				subsampling: "4:4:4",
+				transform:   0,
+			},
+			{
+				name: "AdobeCMYK",
+				segments: [][]byte{adobe(0), sof(8,
+					[3]byte{1, 0x11, 0}, [3]byte{2, 0x11, 0}, [3]byte{3, 0x11, 0}, [3]byte{4, 0x11, 0})},
+				precision:   8,
+				colorSpace:  extractor.JPEGColorSpaceCMYK,
+				subsampling: "4:4:4",
+				transform:   0,
+			},
+			{
+				name: "AdobeYCCK",
+				segments: [][]byte{adobe(2), sof(8,
+					[3]byte{1, 0x22, 0}, [3]byte{2, 0x11, 1}, [3]byte{3, 0x11, 1}, [3]byte{4, 0x22, 0})},
+				precision:   8,
+				colorSpace:  extractor.JPEGColorSpaceYCCK,
+				subsampling: "4:2:0",
+				transform:   2,
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				buf := mergeBuffers(jpegMinimalHeader[:2], mergeBuffers(tt.segments...), []byte{0xFF, 0xDA})
+
+				info, err := jpeg.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.Precision != tt.precision {
+					t.Errorf("expected precision %d, got %d", tt.precision, info.Precision)
+				}
+
+				if info.ColorSpace != tt.colorSpace {
+					t.Errorf("expected color space %s, got %s", tt.colorSpace, info.ColorSpace)
+				}
+
+				if subsampling := info.ChromaSubsampling(); subsampling != tt.subsampling {
+					t.Errorf("expected subsampling %q, got %q", tt.subsampling, subsampling)
+				}
+
+				if info.Adobe != (tt.transform >= 0) || (info.Adobe && int(info.AdobeTransform) != tt.transform) {
+					t.Errorf("expected Adobe transform %d, got %v (%d)", tt.transform, info.Adobe, info.AdobeTransform)
+				}
+			})
+		}
+
+		info, err := jpeg.ExtractInfo(bytes.NewReader(mergeBuffers(
+			jpegMinimalHeader[:2], sof(8, [3]byte{1, 0x22, 2}, [3]byte{2, 0x11, 1}, [3]byte{3, 0x11, 1}),
+		)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := extractor.JPEGComponent{ID: 1, HorizontalSampling: 2, VerticalSampling: 2, QuantizationTable: 2}
+		if len(info.Components) != 3 || info.Components[0] != expected {
+			t.Errorf("expected luma component %+v, got %+v", expected, info.Components)
+		}
+	})
+
+	t.Run("EstimateQuality", func(t *testing.T) {
+		img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+		for _, quality := range []int{10, 50, 75, 90, 100} {
+			var encoded bytes.Buffer
+			if err := stdjpeg.Encode(&encoded, img, &stdjpeg.Options{Quality: quality}); err != nil {
+				t.Fatalf("failed to encode image: %v", err)
+			}
+
+			info, err := extractor.JPEG{EstimateQuality: true}.ExtractInfo(bytes.NewReader(encoded.Bytes()))
+			if err != nil {
+				t.Fatalf("quality %d: expected no error, got %v", quality, err)
+			}
+
+			if info.Quality != quality {
+				t.Errorf("expected quality %d, got %d", quality, info.Quality)
+			}
+
+			info, err = jpeg.ExtractInfo(bytes.NewReader(encoded.Bytes()))
+			if err != nil {
+				t.Fatalf("quality %d: expected no error, got %v", quality, err)
+			}
+
+			if info.Quality != 0 {
+				t.Errorf("expected no quality estimate unless requested, got %d", info.Quality)
+			}
+		}
+	})
+
+	t.Run("EstimateQualityFromExtendedTableAfterFrame", func(t *testing.T) {
+		// 16-bit table of quality 100 defined between the frame header and the scan
+		table := []byte{0x10}
+		for i := 0; i < 64; i++ {
+			table = append(table, 0x00, 0x01)
+		}
+
+		buf := mergeBuffers(
+			jpegMinimalHeader[:2],
+			[]byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00},
+			[]byte{0xFF, 0xDB}, be16(uint16(2+len(table))), table,
+			[]byte{0xFF, 0xDA},
+		)
+
+		info, err := extractor.JPEG{EstimateQuality: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Quality != 100 {
+			t.Errorf("expected quality 100, got %d", info.Quality)
+		}
+
+		// Truncated table
+		buf = mergeBuffers(
+			jpegMinimalHeader[:2],
+			[]byte{0xFF, 0xDB}, be16(uint16(2+10)), table[:10],
+			[]byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00},
+		)
+
+		if _, err := (extractor.JPEG{EstimateQuality: true}).ExtractInfo(bytes.NewReader(buf)); err == nil {
+			t.Error("expected error due to truncated quantization table, got nil")
+		}
+	})
+
+	t.Run("CountScans", func(t *testing.T) {
+		scan := []byte{0xFF, 0xDA, 0x00, 0x08, 0x01, 0x01, 0x00, 0x00, 0x3F, 0x00}
+		entropyCodedData := []byte{0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56, 0xFF, 0xFF, 0xD7, 0x78}
+		buf := mergeBuffers(
+			jpegMinimalHeader[:2],
+			[]byte{0xFF, 0xC2, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00},
+			scan, entropyCodedData,
+			[]byte{0xFF, 0xC4, 0x00, 0x03, 0x00}, // DHT between scans
+			scan, entropyCodedData,
+			[]byte{0xFF, 0xD9},
+		)
+
+		info, err := extractor.JPEG{CountScans: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !info.Progressive || info.Scans != 2 || info.Truncated {
+			t.Errorf("expected a complete progressive image with 2 scans, got %+v", info)
+		}
+
+		for _, size := range []int{len(buf) - 2, len(buf) - 14} {
+			info, err := extractor.JPEG{CountScans: true}.ExtractInfo(bytes.NewReader(buf[:size]))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if !info.Truncated {
+				t.Errorf("%d bytes: expected truncated image, got %+v", size, info)
+			}
+		}
+
+		info, err = jpeg.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !info.Progressive || info.Scans != 0 {
+			t.Errorf("expected a progressive image without scan count unless requested, got %+v", info)
+		}
+	})
+
+	t.Run("CountScansOfValidImage", func(t *testing.T) {
+		data, err := os.ReadFile("../_testdata/jpeg/20x20.jpg")
+		if err != nil {
+			t.Fatalf("failed to read test file: %v", err)
+		}
+
+		info, err := extractor.JPEG{CountScans: true}.ExtractInfo(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Progressive || info.Scans != 1 || info.Truncated {
+			t.Errorf("expected a complete baseline image with a single scan, got %+v", info)
+		}
+	})
+
+	t.Run("ExtractEmbeddedImages", func(t *testing.T) {
+		data, err := os.ReadFile("../_testdata/jpeg/64x32.mpo")
+		if err != nil {
+			t.Fatalf("failed to read test file: %v", err)
+		}
+
+		info, err := extractor.JPEG{ReadEmbeddedImages: true}.ExtractInfo(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Format() != "mpo" {
+			t.Errorf("expected format mpo, got %q", info.Format())
+		}
+
+		expected := []struct {
+			typ           extractor.JPEGImageType
+			width, height int
+		}{
+			{extractor.JPEGImageThumbnail, 16, 8},
+			{extractor.JPEGImagePrimary, 64, 32},
+			{extractor.JPEGImageDisparity, 32, 16},
+		}
+
+		if len(info.EmbeddedImages) != len(expected) {
+			t.Fatalf("expected %d embedded images, got %+v", len(expected), info.EmbeddedImages)
+		}
+
+		for i, image := range info.EmbeddedImages {
+			if image.Type != expected[i].typ || image.Width != expected[i].width || image.Height != expected[i].height {
+				t.Errorf("image %d: expected %s %dx%d, got %s %dx%d", i, expected[i].typ,
+					expected[i].width, expected[i].height, image.Type, image.Width, image.Height)
+			}
+
+			end := image.Offset + image.Length
+			if end > int64(len(data)) || !bytes.HasPrefix(data[image.Offset:end], []byte{0xFF, 0xD8}) {
+				t.Errorf("image %d: expected JPEG data at %d-%d", i, image.Offset, end)
+			}
+		}
+
+		// The secondary image ends the file
+		if last := info.EmbeddedImages[2]; last.Offset+last.Length != int64(len(data)) {
+			t.Errorf("expected the secondary image to end the file, got %d-%d", last.Offset, last.Offset+last.Length)
+		}
+
+		// Dimensions are only read on request
+		info, err = jpeg.ExtractInfo(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(info.EmbeddedImages) != 3 || info.EmbeddedImages[2].Width != 0 {
+			t.Errorf("expected embedded images without dimensions, got %+v", info.EmbeddedImages)
+		}
+	})
+
+	t.Run("SingleImageIsNotMPO", func(t *testing.T) {
+		data, err := os.ReadFile("../_testdata/jpeg/20x20.jpg")
+		if err != nil {
+			t.Fatalf("failed to read test file: %v", err)
+		}
+
+		info, err := extractor.JPEG{ReadEmbeddedImages: true}.ExtractInfo(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Format() != "" || len(info.EmbeddedImages) != 0 {
+			t.Errorf("expected no embedded images, got %q %+v", info.Format(), info.EmbeddedImages)
+		}
+	})
+
+	t.Run("ExtractUltraHDRGainMap", func(t *testing.T) {
+		encode := func(width, height int) []byte {
+			var encoded bytes.Buffer
+			if err := stdjpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+				t.Fatalf("failed to encode image: %v", err)
+			}
+			return encoded.Bytes()
+		}
+
+		xmp := mergeBuffers(
+			[]byte("http://ns.adobe.com/xap/1.0/\x00"),
+			[]byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">`+
+				`<rdf:Description xmlns:hdrgm="http://ns.adobe.com/hdr-gain-map/1.0/" hdrgm:Version="1.0"/>`+
+				`</rdf:RDF></x:xmpmeta>`),
+		)
+		xmpSegment := mergeBuffers([]byte{0xFF, 0xE1}, be16(uint16(2+len(xmp))), xmp)
+
+		base, gainMap := encode(64, 32), encode(16, 8)
+		file := func(xmp []byte) []byte {
+			// The MP header follows the APP2 marker, length and "MPF\0"
+			headerOffset := uint32(2 + len(xmp) + 8)
+			primary := func(size, gainMapOffset uint32) []byte {
+				return mergeBuffers(base[:2], xmp, mpfSegment(
+					[3]uint32{0x20030000, size, 0},
+					[3]uint32{0x00000000, uint32(len(gainMap)), gainMapOffset},
+				), base[2:])
+			}
+
+			size := uint32(len(primary(0, 0)))
+			return mergeBuffers(primary(size, size-headerOffset), gainMap)
+		}
+
+		info, err := jpeg.ExtractInfo(bytes.NewReader(file(xmpSegment)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := extractor.GainMap{Source: extractor.GainMapUltraHDR, Width: 16, Height: 8}
+		if info.Width != 64 || info.Height != 32 || info.GainMap == nil || *info.GainMap != expected {
+			t.Errorf("expected base image 64x32 with gain map %+v, got %dx%d with %+v",
+				expected, info.Width, info.Height, info.GainMap)
+		}
+
+		if len(info.EmbeddedImages) != 2 || info.EmbeddedImages[1].Type != extractor.JPEGImageGainMap {
+			t.Errorf("expected the secondary image to be the gain map, got %+v", info.EmbeddedImages)
+		}
+
+		// Without hdrgm metadata, the secondary image is not a gain map
+		info, err = jpeg.ExtractInfo(bytes.NewReader(file(nil)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.GainMap != nil || info.Format() != "mpo" {
+			t.Errorf("expected an MPO file without gain map, got %q with %+v", info.Format(), info.GainMap)
+		}
+
+		// Ultra HDR files nested in the images of one another, each listing the next one 40 times:
+		// as a gain map and as 39 disparity images
+		nest := func(inner []byte) []byte {
+			headerOffset := uint32(2 + len(xmpSegment) + 8)
+			primary := func(size uint32) []byte {
+				images := [][3]uint32{{0x20030000, size, 0}, {0x00000000, uint32(len(inner)), size - headerOffset}}
+				for i := 0; i < 39; i++ {
+					images = append(images, [3]uint32{0x00020002, uint32(len(inner)), size - headerOffset})
+				}
+				return mergeBuffers(base[:2], xmpSegment, mpfSegment(images...), base[2:])
+			}
+
+			size := uint32(len(primary(0)))
+			return mergeBuffers(primary(size), inner)
+		}
+		nested := nest(nest(nest(gainMap)))
+
+		// Only the frame header of the gain map is read by default, and nested images are never read
+		for _, e := range []extractor.JPEG{jpeg, {ReadEmbeddedImages: true}} {
+			reader := &countingReader{ReadSeeker: bytes.NewReader(nested)}
+			info, err = e.ExtractInfo(reader)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			expected := extractor.GainMap{Source: extractor.GainMapUltraHDR, Width: 64, Height: 32}
+			if info.GainMap == nil || *info.GainMap != expected || len(info.EmbeddedImages) != 41 {
+				t.Errorf("expected gain map %+v among 41 images, got %+v", expected, info.GainMap)
+			}
+
+			if disparity := info.EmbeddedImages[2]; (disparity.Width != 0) == !e.ReadEmbeddedImages {
+				t.Errorf("expected disparity images to be read with ReadEmbeddedImages only, got %+v", disparity)
+			}
+
+			// Each of the 41 images is read up to its frame header at most, while following the nested files reads them 40 times per level
+			if reader.read > 2*len(nested) {
+				t.Errorf("expected nested images not to be read, read %d bytes of %d", reader.read, len(nested))
+			}
+		}
+	})
+
+	t.Run("ReadColorProfile", func(t *testing.T) {
+		icc := iccProfile("desc", "sRGB IEC61966-2.1")
+		chunk := func(sequence, count byte, data []byte) []byte {
+			payload := mergeBuffers([]byte("ICC_PROFILE\x00"), []byte{sequence, count}, data)
+			return mergeBuffers([]byte{0xFF, 0xE2}, be16(uint16(2+len(payload))), payload)
+		}
+		sof := []byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00}
+
+		// Chunks are reassembled by sequence number
+		buf := mergeBuffers(jpegMinimalHeader[:2], chunk(2, 2, icc[100:]), chunk(1, 2, icc[:100]), sof)
+
+		info, err := extractor.JPEG{ReadColorProfile: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.ColorProfile == nil || !bytes.Equal(info.ColorProfile.ICC, icc) ||
+			info.ColorProfile.Description != "sRGB IEC61966-2.1" || info.ColorProfile.ColorSpace != "RGB" {
+			t.Errorf("expected the reassembled sRGB profile, got %+v", info.ColorProfile)
+		}
+
+		info, err = jpeg.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.ColorProfile != nil {
+			t.Errorf("expected no color profile unless requested, got %+v", info.ColorProfile)
+		}
+
+		// Chunks are skipped unless requested
+		reader := &countingReader{ReadSeeker: bytes.NewReader(buf)}
+		if _, err := jpeg.ExtractInfo(reader); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if reader.read >= len(icc) {
+			t.Errorf("expected the chunks to be skipped, got %d bytes read", reader.read)
+		}
+
+		// Incomplete profiles are ignored
+		buf = mergeBuffers(jpegMinimalHeader[:2], chunk(1, 2, icc[:100]), sof)
+
+		info, err = extractor.JPEG{ReadColorProfile: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.ColorProfile != nil {
+			t.Errorf("expected no color profile for a missing chunk, got %+v", info.ColorProfile)
+		}
+	})
+
+	t.Run("ReadXMP", func(t *testing.T) {
+		app1 := func(payload ...[]byte) []byte {
+			data := mergeBuffers(payload...)
+			return mergeBuffers([]byte{0xFF, 0xE1}, be16(uint16(2+len(data))), data)
+		}
+		sof := []byte{0xFF, 0xC0, 0x00, 0x0B, 0x08, 0x00, 0x02, 0x00, 0x01, 0x01, 0x01, 0x11, 0x00}
+
+		guid := []byte("0123456789ABCDEF0123456789ABCDEF")
+		packet := xmpPacket(`xmp:Rating="5" xmpNote:HasExtendedXMP="`+string(guid)+`"`, "")
+		extended := xmpPacket("", `<dc:description><rdf:Alt><rdf:li xml:lang="x-default">Extended</rdf:li></rdf:Alt></dc:description>`)
+		extension := func(offset int) []byte {
+			end := offset + 100
+			if end > len(extended) {
+				end = len(extended)
+			}
+			return app1([]byte("http://ns.adobe.com/xmp/extension/\x00"), guid, be32(uint32(len(extended))), be32(uint32(offset)), extended[offset:end])
+		}
+
+		// Segments of the Extended XMP may come in any order
+		var extensions [][]byte
+		for offset := 0; offset < len(extended); offset += 100 {
+			extensions = append(extensions, extension(offset))
+		}
+		extensions[0], extensions[1] = extensions[1], extensions[0]
+
+		buf := mergeBuffers(jpegMinimalHeader[:2], app1([]byte("http://ns.adobe.com/xap/1.0/\x00"), packet), mergeBuffers(extensions...), sof)
+
+		info, err := extractor.JPEG{ReadXMP: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP == nil || !bytes.Equal(info.XMP.Packet, packet) || !bytes.Equal(info.XMP.Extended, extended) {
+			t.Fatalf("expected the packet and its reassembled Extended XMP, got %+v", info.XMP)
+		}
+
+		if info.XMP.Properties["xmp:Rating"] != "5" || info.XMP.Properties["dc:description"] != "Extended" {
+			t.Errorf("expected the properties of both packets, got %v", info.XMP.Properties)
+		}
+
+		// Packets and Extended XMP are skipped unless requested
+		reader := &countingReader{ReadSeeker: bytes.NewReader(buf)}
+		if _, err := jpeg.ExtractInfo(reader); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if reader.read >= len(packet) {
+			t.Errorf("expected the XMP segments to be skipped, got %d bytes read", reader.read)
+		}
+
+		// Extended XMP missing a segment is left out, even if another segment is repeated
+		buf = mergeBuffers(jpegMinimalHeader[:2], app1([]byte("http://ns.adobe.com/xap/1.0/\x00"), packet),
+			extensions[0], extensions[1], mergeBuffers(extensions[3:]...), extensions[0], sof)
+
+		info, err = extractor.JPEG{ReadXMP: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP == nil || info.XMP.Extended != nil || info.XMP.Properties["xmp:Rating"] != "5" {
+			t.Errorf("expected the packet without Extended XMP, got %+v", info.XMP)
+		}
+
+		// The XMP tag of the EXIF data is used without XMP segment
+		exif := exifBlock(binary.BigEndian, []tiffTestEntry{{tag: 700, typ: 7, count: uint32(len(packet)), value: packet}})
+		buf = mergeBuffers(jpegMinimalHeader[:2], app1(exif), sof)
+
+		info, err = extractor.JPEG{ReadXMP: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP == nil || !bytes.Equal(info.XMP.Packet, packet) {
+			t.Errorf("expected the packet of the EXIF data, got %+v", info.XMP)
+		}
+
+		info, err = jpeg.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP != nil {
+			t.Errorf("expected no XMP unless requested, got %+v", info.XMP)
+		}
+	})
+
+	t.Run("StopMarkerReached", func(t *testing.T) {
+		buf := mergeBuffers(jpegMinimalHeader[:2], []byte{0xFF, 0xC4, 0x00, 0x02, 0xFF, 0xDA})
+
+		if _, _, err := jpeg.ExtractSize(bytes.NewReader(buf)); err == nil {
+			t.Fatal("expected error due to missing SOF marker, got nil")
+		}
+	})
+
 	t.Run("CorruptedImage", func(t *testing.T) {
 		invalidJPEG := mergeBuffers(
 			jpegHeader,
@@ -96,7 +909,7 @@ func TestJPEG(t *testing.T) {
 		)
 
 		reader := bytes.NewReader(invalidJPEG)
-		_, _, err := extractor.ExtractSize(reader)
+		_, _, err := jpeg.ExtractSize(reader)
 
 		if err == nil {
 			t.Fatalf("expected error due to missing height, got nil")
@@ -105,7 +918,7 @@ func TestJPEG(t *testing.T) {
 
 	t.Run("InvalidImageFormatDetection", func(t *testing.T) {
 		nonJPEG := []byte("NOTJPEGHEADER")
-		_, matched := extractor.MatchFormat(nonJPEG)
+		_, matched := jpeg.MatchFormat(nonJPEG)
 
 		if matched {
 			t.Error("expected no match for non-JPEG file")
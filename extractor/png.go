@@ -2,18 +2,162 @@ package extractor
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/pillowskiy/imagesize/imagebytes"
 	"github.com/pillowskiy/imagesize/imagerrors"
 )
 
-var (
-	pngHeader  = []byte("\x89\x50\x4E\x47")
-	ihdrHeader = []byte("IHDR")
+var pngHeader = []byte("\x89\x50\x4E\x47")
+
+const (
+	// Length of the PNG signature preceding the first chunk.
+	pngSignatureSize = 8
+
+	// Length of the IHDR chunk data.
+	pngIHDRSize = 13
+
+	// Upper bounds of the size of a text chunk once decompressed and of the number of text chunks read.
+	maxPNGTextSize    = 1 << 20
+	maxPNGTextEntries = 512
+
+	// Keyword of the iTXt chunk holding the XMP packet.
+	pngXMPKeyword = "XML:com.adobe.xmp"
+)
+
+// PNGColorType is the color type of the IHDR chunk, telling how pixels are stored.
+type PNGColorType uint8
+
+const (
+	PNGColorGrayscale      PNGColorType = 0
+	PNGColorRGB            PNGColorType = 2
+	PNGColorPalette        PNGColorType = 3
+	PNGColorGrayscaleAlpha PNGColorType = 4
+	PNGColorRGBA           PNGColorType = 6
 )
 
+func (c PNGColorType) String() string {
+	switch c {
+	case PNGColorGrayscale:
+		return "Grayscale"
+	case PNGColorRGB:
+		return "RGB"
+	case PNGColorPalette:
+		return "Palette"
+	case PNGColorGrayscaleAlpha:
+		return "GrayscaleAlpha"
+	case PNGColorRGBA:
+		return "RGBA"
+	default:
+		return fmt.Sprintf("PNGColorType(%d)", uint8(c))
+	}
+}
+
+// HasAlpha reports whether pixels of this color type carry an alpha channel.
+func (c PNGColorType) HasAlpha() bool {
+	return c == PNGColorGrayscaleAlpha || c == PNGColorRGBA
+}
+
+// PNGInterlace is the interlace method of the IHDR chunk.
+type PNGInterlace uint8
+
+const (
+	PNGInterlaceNone  PNGInterlace = 0
+	PNGInterlaceAdam7 PNGInterlace = 1
+)
+
+func (i PNGInterlace) String() string {
+	switch i {
+	case PNGInterlaceNone:
+		return "None"
+	case PNGInterlaceAdam7:
+		return "Adam7"
+	default:
+		return fmt.Sprintf("PNGInterlace(%d)", uint8(i))
+	}
+}
+
+// PNGText is the entry of a tEXt, zTXt or iTXt chunk.
+type PNGText struct {
+	// Type of the chunk, "tEXt", "zTXt" or "iTXt".
+	Chunk string
+
+	// Keyword, e.g. "Title", "Comment" or "parameters".
+	Keyword string
+
+	// Text, decompressed for zTXt and compressed iTXt chunks. The Latin-1 keywords and text
+	// of tEXt and zTXt chunks are converted to UTF-8.
+	Text       string
+	Compressed bool
+
+	// Language tag (e.g. "en-US") and translation of the keyword of iTXt chunks, empty otherwise.
+	Language          string
+	TranslatedKeyword string
+}
+
+// PNGInfo contains the information extracted from a PNG file.
+// The IHDR fields following the size are zero when the file ends right after the size.
+type PNGInfo struct {
+	Width  int
+	Height int
+
+	// Bits per sample, or per palette index for PNGColorPalette (1, 2, 4, 8 or 16).
+	BitDepth uint8
+
+	ColorType PNGColorType
+
+	// Compression and filter methods, 0 being the only methods defined by the specification.
+	CompressionMethod uint8
+	FilterMethod      uint8
+
+	InterlaceMethod PNGInterlace
+
+	// Transparency reports a tRNS chunk, which gives transparency to color types without alpha channel:
+	// alpha values of palette entries, or a single transparent gray level or RGB color.
+	Transparency bool
+
+	// AppleOptimized reports a CgBI chunk preceding IHDR, written by Apple tools for iOS.
+	// Such files store premultiplied BGRA pixels with a raw deflate stream instead of zlib,
+	// so they cannot be decoded by standard PNG decoders.
+	AppleOptimized bool
+
+	// Animation of APNG files from the acTL chunk, nil for still images.
+	// Its duration is only known with PNG.TotalDuration.
+	Animation *Animation
+
+	// Orientation from the eXIf chunk, if any.
+	OrientedSize
+
+	// Resolution from the pHYs chunk, or else from the eXIf chunk.
+	// ResolutionConflict reports that both are present and differ.
+	Resolution
+
+	// Color information of the iCCP, sRGB, gAMA, cICP and cHRM chunks, read with PNG.ReadColorProfile.
+	// Nil otherwise or when the image has none.
+	ColorProfile *ColorProfile
+
+	// XMP packet of the iTXt chunk with the "XML:com.adobe.xmp" keyword, or else of the eXIf chunk,
+	// read with PNG.ReadXMP. Nil otherwise or when the image has none.
+	XMP *XMP
+
+	// Entries of the text chunks in file order, read with PNG.ReadText. Nil otherwise.
+	Text []PNGText
+
+	// EXIF data of the eXIf chunk and resolution of the pHYs chunk.
+	exif *tiffData
+	phys Resolution
+}
+
+// HasAlpha reports whether the image has an alpha channel or transparency from a tRNS chunk.
+func (i *PNGInfo) HasAlpha() bool {
+	return i.ColorType.HasAlpha() || i.Transparency
+}
+
 // PNG defines an extractor for PNG image format.
 //
 // The PNG file format starts with a specific header and chunk structure:
@@ -26,7 +170,30 @@ var (
 // 3. The next 4 bytes contain the ASCII characters "IHDR", identifying the chunk as the image header.
 // 4. The next 4 bytes represent the width of the image (1 pixel in this case), encoded as a 32-bit unsigned integer in big-endian format.
 // 5. The next 4 bytes represent the height of the image (1 pixel in this case), also encoded as a 32-bit unsigned integer in big-endian format.
-type PNG struct{}
+//
+// Apple optimized PNGs insert a CgBI chunk before IHDR, any other first chunk is invalid.
+//
+// Animated PNGs (APNG) announce their frames in an acTL chunk preceding the image data (IDAT),
+// each frame being described by an fcTL chunk.
+// See https://wiki.mozilla.org/APNG_Specification
+type PNG struct {
+	// TotalDuration walks the chunks of animated PNGs up to the end of the file to sum the delays
+	// of their fcTL chunks, instead of stopping at the image data.
+	TotalDuration bool
+
+	// ReadColorProfile reads the iCCP, sRGB, gAMA, cICP and cHRM chunks, see PNGInfo.ColorProfile.
+	ReadColorProfile bool
+
+	// ReadXMP reads the XMP packet of the iTXt chunks, see PNGInfo.XMP.
+	ReadXMP bool
+
+	// ReadText collects the tEXt, zTXt and iTXt chunks preceding the image data, see PNGInfo.Text.
+	ReadText bool
+
+	// TextAfterImageData walks the chunks up to the end of the file with ReadText,
+	// as text chunks may also follow the image data.
+	TextAfterImageData bool
+}
 
 func (e PNG) BufSize() int {
 	return len(pngHeader)
@@ -37,30 +204,428 @@ func (e PNG) MatchFormat(buf []byte) (string, bool) {
 }
 
 func (e PNG) ExtractSize(reader io.ReadSeeker) (width, height int, err error) {
-	if _, err = reader.Seek(12, io.SeekStart); err != nil {
-		err = fmt.Errorf("failed to seek to the start of the file: %w", err)
+	info, err := e.ExtractInfo(reader)
+	if err != nil {
 		return
 	}
 
-	var buf [4]byte
-	// Read potential IHDR header (12:16)
-	_, err = io.ReadFull(reader, buf[:])
+	return info.Width, info.Height, nil
+}
+
+// ExtractDetails implements imagesize.DetailsExtractor, the details are of type *PNGInfo.
+func (e PNG) ExtractDetails(reader io.ReadSeeker) (width, height int, details interface{}, err error) {
+	info, err := e.ExtractInfo(reader)
 	if err != nil {
-		err = fmt.Errorf("failed to read the first 4 bytes: %w", err)
 		return
 	}
 
-	var skipHeaderBytesCount int64 = 8
-	if bytes.Equal(buf[:], ihdrHeader) {
-		skipHeaderBytesCount = 16
+	return info.Width, info.Height, info, nil
+}
+
+// ExtractInfo extracts the IHDR fields, then walks the chunks preceding the image data
+// for animation (acTL), transparency (tRNS), resolution (pHYs) and orientation (eXIf).
+func (e PNG) ExtractInfo(reader io.ReadSeeker) (*PNGInfo, error) {
+	info := new(PNGInfo)
+
+	offset := int64(pngSignatureSize)
+	length, chunkType, err := e.readChunkHeader(reader, offset)
+	if err != nil {
+		return nil, err
 	}
 
-	if _, err = reader.Seek(skipHeaderBytesCount, io.SeekStart); err != nil {
-		err = fmt.Errorf("failed to seek to correct position: %w", err)
-		return
+	if chunkType == "CgBI" {
+		info.AppleOptimized = true
+
+		offset += 8 + int64(length) + 4
+		if length, chunkType, err = e.readChunkHeader(reader, offset); err != nil {
+			return nil, err
+		}
+	}
+
+	if chunkType != "IHDR" {
+		return nil, fmt.Errorf("corrupted image: expected IHDR as the first chunk, got %q", chunkType)
+	}
+	if length != pngIHDRSize {
+		return nil, fmt.Errorf("corrupted image: invalid IHDR length %d", length)
 	}
 
 	widthU32, widthErr := imagebytes.ReadU32(reader, imagebytes.BigEndian)
 	heightU32, heightErr := imagebytes.ReadU32(reader, imagebytes.BigEndian)
-	return int(widthU32), int(heightU32), imagerrors.Join(widthErr, heightErr)
+	if err := imagerrors.Join(widthErr, heightErr); err != nil {
+		return nil, err
+	}
+
+	info.Width, info.Height = int(widthU32), int(heightU32)
+	info.OrientedSize = orientedSize(nil, info.Width, info.Height)
+
+	// Bit depth, color type, compression, filter and interlace methods
+	var fields [5]byte
+	if _, err := io.ReadFull(reader, fields[:]); err != nil {
+		if isEOF(err) {
+			return info, nil
+		}
+		return nil, fmt.Errorf("failed to read IHDR fields: %w", err)
+	}
+
+	info.BitDepth = fields[0]
+	info.ColorType = PNGColorType(fields[1])
+	info.CompressionMethod = fields[2]
+	info.FilterMethod = fields[3]
+	info.InterlaceMethod = PNGInterlace(fields[4])
+
+	if err := e.readChunks(reader, info, offset+8+int64(length)+4); err != nil {
+		return nil, err
+	}
+
+	info.OrientedSize = orientedSize(info.exif, info.Width, info.Height)
+	info.Resolution = resolveResolution(info.OrientedSize, info.phys, exifResolution(info.exif))
+
+	if e.ReadXMP && info.XMP == nil && info.exif != nil {
+		if packet := info.exif.xmp(); packet != nil {
+			info.XMP = newXMP(packet)
+		}
+	}
+	return info, nil
+}
+
+// Reads a chunk describing the color space of the image, ignoring malformed chunks.
+func (e PNG) readColorChunk(chunkType string, data []byte, profile *ColorProfile) {
+	switch chunkType {
+	case "iCCP":
+		// Profile name (1-79 bytes), null separator, compression method (1) and the zlib compressed profile
+		separator := bytes.IndexByte(data, 0)
+		if separator < 1 || separator+2 > len(data) || data[separator+1] != 0 {
+			return
+		}
+
+		icc, err := inflate(data[separator+2:], maxICCSize)
+		if err != nil {
+			return
+		}
+
+		// The ICC profile supersedes the cHRM chunk
+		parsed := newICCColorProfile(icc)
+		profile.ICC, profile.Description, profile.ColorSpace = parsed.ICC, parsed.Description, parsed.ColorSpace
+		if parsed.Primaries != nil {
+			profile.Primaries = parsed.Primaries
+		}
+	case "sRGB":
+		if len(data) == 1 {
+			profile.SRGB, profile.RenderingIntent = true, data[0]
+		}
+	case "gAMA":
+		if len(data) == 4 {
+			profile.Gamma = float64(binary.BigEndian.Uint32(data)) / 100000
+		}
+	case "cICP":
+		// Color primaries, transfer function, matrix coefficients and video full range flag (1 each)
+		if len(data) == 4 {
+			profile.CICP = &CICP{
+				ColorPrimaries:          uint16(data[0]),
+				TransferCharacteristics: uint16(data[1]),
+				MatrixCoefficients:      uint16(data[2]),
+				FullRange:               data[3] != 0,
+			}
+		}
+	case "cHRM":
+		// White point, red, green and blue x and y (4 each), times 100000
+		if len(data) != 32 || profile.ICC != nil {
+			return
+		}
+
+		point := func(i int) Chromaticity {
+			return Chromaticity{
+				X: float64(binary.BigEndian.Uint32(data[8*i:])) / 100000,
+				Y: float64(binary.BigEndian.Uint32(data[8*i+4:])) / 100000,
+			}
+		}
+		profile.Primaries = &Primaries{White: point(0), Red: point(1), Green: point(2), Blue: point(3)}
+	}
+}
+
+// Reads a text chunk into PNGInfo.Text and the XMP packet of iTXt chunks, ignoring malformed chunks.
+func (e PNG) readTextChunk(chunkType string, data []byte, info *PNGInfo) {
+	separator := bytes.IndexByte(data, 0)
+	if separator < 1 {
+		return
+	}
+
+	isXMP := chunkType == "iTXt" && string(data[:separator]) == pngXMPKeyword
+	limit := int64(maxPNGTextSize)
+	if isXMP {
+		limit = maxXMPSize
+	}
+
+	text, err := parsePNGText(chunkType, data, limit)
+	if err != nil {
+		return
+	}
+
+	if isXMP && e.ReadXMP && info.XMP == nil {
+		info.XMP = newXMP([]byte(text.Text))
+	}
+	if e.ReadText && len(info.Text) < maxPNGTextEntries && len(text.Text) <= maxPNGTextSize {
+		info.Text = append(info.Text, text)
+	}
+}
+
+// Reads a tEXt chunk: keyword (1-79 bytes), null separator and text, or a zTXt chunk: keyword,
+// null separator, compression method (1) and the zlib compressed text, or an iTXt chunk.
+func parsePNGText(chunkType string, data []byte, limit int64) (PNGText, error) {
+	text := PNGText{Chunk: chunkType}
+	if chunkType == "iTXt" {
+		keyword, language, translatedKeyword, utf8, err := parsePNGITXt(data, limit)
+		if err != nil {
+			return text, err
+		}
+
+		text.Keyword, text.Language, text.TranslatedKeyword, text.Text = keyword, language, translatedKeyword, string(utf8)
+		text.Compressed = data[len(keyword)+1] != 0
+		return text, nil
+	}
+
+	separator := bytes.IndexByte(data, 0)
+	if separator < 1 {
+		return text, fmt.Errorf("corrupted image: invalid %s chunk", chunkType)
+	}
+	text.Keyword = latin1String(data[:separator])
+	latin1 := data[separator+1:]
+
+	if chunkType == "zTXt" {
+		if len(latin1) < 1 || latin1[0] != 0 {
+			return text, errors.New("unsupported zTXt compression method")
+		}
+
+		inflated, err := inflate(latin1[1:], limit)
+		if err != nil {
+			return text, err
+		}
+		latin1, text.Compressed = inflated, true
+	} else if int64(len(latin1)) > limit {
+		return text, errors.New("text exceeds the size limit")
+	}
+
+	text.Text = latin1String(latin1)
+	return text, nil
+}
+
+// Converts Latin-1 (ISO 8859-1) bytes to a string, each byte being a code point.
+func latin1String(latin1 []byte) string {
+	runes := make([]rune, len(latin1))
+	for i, b := range latin1 {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// Reads an iTXt chunk: keyword (1-79 bytes), null separator, compression flag (1) and method (1),
+// language tag, null separator, translated keyword, null separator and the UTF-8 text,
+// which is zlib compressed with the compression flag and may not exceed limit once decompressed.
+func parsePNGITXt(data []byte, limit int64) (keyword, language, translatedKeyword string, text []byte, err error) {
+	separator := bytes.IndexByte(data, 0)
+	if separator < 1 || separator+3 > len(data) {
+		err = errors.New("corrupted image: invalid iTXt chunk")
+		return
+	}
+
+	keyword = string(data[:separator])
+	compressed, method := data[separator+1] != 0, data[separator+2]
+	rest := data[separator+3:]
+
+	fields := bytes.SplitN(rest, []byte{0}, 3)
+	if len(fields) != 3 {
+		err = errors.New("corrupted image: invalid iTXt chunk")
+		return
+	}
+	language, translatedKeyword, text = string(fields[0]), string(fields[1]), fields[2]
+
+	switch {
+	case compressed && method != 0:
+		err = fmt.Errorf("unsupported iTXt compression method %d", method)
+	case compressed:
+		text, err = inflate(text, limit)
+	case int64(len(text)) > limit:
+		err = errors.New("text exceeds the size limit")
+	}
+	return
+}
+
+// Decompresses zlib data, failing on data larger than limit once decompressed.
+func inflate(data []byte, limit int64) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	inflated, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(inflated)) > limit {
+		return nil, errors.New("decompressed data exceeds the size limit")
+	}
+	return inflated, nil
+}
+
+// Reads the length and type of the chunk at the given offset, leaving the reader at its data.
+func (e PNG) readChunkHeader(reader io.ReadSeeker, offset int64) (length uint32, chunkType string, err error) {
+	if _, err = reader.Seek(offset, io.SeekStart); err != nil {
+		err = fmt.Errorf("failed to seek to chunk: %w", err)
+		return
+	}
+
+	// Chunk length (4) and type (4)
+	var header [8]byte
+	if _, err = io.ReadFull(reader, header[:]); err != nil {
+		err = fmt.Errorf("failed to read chunk header: %w", err)
+		return
+	}
+
+	return binary.BigEndian.Uint32(header[:4]), string(header[4:]), nil
+}
+
+// Walks the chunks following IHDR, starting at the given offset, up to the image data,
+// or up to the end of animated files with TotalDuration and of any file with TextAfterImageData.
+// A file ending between two chunks is not an error, as only the header is needed for the size.
+func (e PNG) readChunks(reader io.ReadSeeker, info *PNGInfo, offset int64) error {
+	afterImageData := false
+	for {
+		length, chunkType, err := e.readChunkHeader(reader, offset)
+		if err != nil {
+			if isEOF(err) {
+				return nil
+			}
+			return err
+		}
+
+		isText := chunkType == "tEXt" || chunkType == "zTXt" || chunkType == "iTXt"
+		if afterImageData && chunkType != "fcTL" && chunkType != "IEND" && !(isText && e.TextAfterImageData) {
+			offset += 8 + int64(length) + 4
+			continue
+		}
+
+		switch chunkType {
+		case "IEND":
+			return nil
+		case "IDAT":
+			if (!e.TotalDuration || info.Animation == nil) && (!e.ReadText || !e.TextAfterImageData) {
+				return nil
+			}
+			afterImageData = true
+		case "acTL":
+			// Number of frames (4) and number of plays (4), 0 meaning infinitely
+			var data [8]byte
+			if length != uint32(len(data)) {
+				break
+			}
+			if _, err := io.ReadFull(reader, data[:]); err != nil {
+				return fmt.Errorf("failed to read acTL chunk: %w", err)
+			}
+
+			info.Animation = &Animation{
+				Frames:    int(binary.BigEndian.Uint32(data[:4])),
+				LoopCount: int(binary.BigEndian.Uint32(data[4:])),
+			}
+		case "fcTL":
+			// The frame control data always spans 26 bytes, the delay being in its middle
+			if !e.TotalDuration || info.Animation == nil || length != 26 {
+				break
+			}
+
+			delay, err := e.readFrameDelay(reader)
+			if err != nil {
+				return err
+			}
+			info.Animation.Duration += delay
+		case "tRNS":
+			info.Transparency = !info.ColorType.HasAlpha()
+		case "pHYs":
+			// Pixels per unit along the x (4) and y (4) axes, unit (1): 0 for the aspect ratio only, 1 for meters
+			var data [9]byte
+			if length != uint32(len(data)) {
+				break
+			}
+			if _, err := io.ReadFull(reader, data[:]); err != nil {
+				return fmt.Errorf("failed to read pHYs chunk: %w", err)
+			}
+
+			unit := densityAspectOnly
+			if data[8] == 1 {
+				unit = densityPerMeter
+			}
+
+			x := float64(binary.BigEndian.Uint32(data[:4]))
+			y := float64(binary.BigEndian.Uint32(data[4:8]))
+			info.phys = newResolution(ResolutionPHYs, x, y, unit)
+		case "eXIf":
+			if info.exif != nil || length > maxEXIFSize {
+				break
+			}
+
+			exif := make([]byte, length)
+			if _, err := io.ReadFull(reader, exif); err == nil {
+				info.exif = openEXIF(exif)
+			}
+		case "tEXt", "zTXt", "iTXt":
+			readXMP := chunkType == "iTXt" && e.ReadXMP && info.XMP == nil
+			readText := e.ReadText && len(info.Text) < maxPNGTextEntries
+
+			// Only XMP packets may be larger than text
+			limit := uint32(maxPNGTextSize)
+			if readXMP {
+				limit = maxXMPSize
+			}
+			if (!readXMP && !readText) || length > limit {
+				break
+			}
+
+			data := make([]byte, length)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return fmt.Errorf("failed to read %s chunk: %w", chunkType, err)
+			}
+			e.readTextChunk(chunkType, data, info)
+		case "iCCP", "sRGB", "gAMA", "cICP", "cHRM":
+			if !e.ReadColorProfile || length > maxICCSize {
+				break
+			}
+
+			data := make([]byte, length)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return fmt.Errorf("failed to read %s chunk: %w", chunkType, err)
+			}
+
+			if info.ColorProfile == nil {
+				info.ColorProfile = new(ColorProfile)
+			}
+			e.readColorChunk(chunkType, data, info.ColorProfile)
+		}
+
+		// Skip the chunk data and CRC
+		offset += 8 + int64(length) + 4
+	}
+}
+
+// Reads the delay of the frame described by an fcTL chunk.
+func (e PNG) readFrameDelay(reader io.Reader) (time.Duration, error) {
+	// Sequence number, width, height, x and y offsets precede the delay numerator and denominator
+	var data [24]byte
+	if _, err := io.ReadFull(reader, data[:]); err != nil {
+		return 0, fmt.Errorf("failed to read fcTL chunk: %w", err)
+	}
+
+	numerator := binary.BigEndian.Uint16(data[20:22])
+	denominator := binary.BigEndian.Uint16(data[22:24])
+
+	// A zero denominator means hundredths of a second
+	if denominator == 0 {
+		denominator = 100
+	}
+	return timescaleDuration(uint64(numerator), uint32(denominator)), nil
+}
+
+// Reports whether the error tells that the data ended early.
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
 }
@@ -2,14 +2,25 @@ package extractor_test
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pillowskiy/imagesize/extractor"
 )
 
+// Builds a PNG chunk with a zero CRC, which is not verified.
+func pngChunk(chunkType string, data []byte) []byte {
+	return mergeBuffers(be32(uint32(len(data))), []byte(chunkType), data, make([]byte, 4))
+}
+
 func TestPNG(t *testing.T) {
 	t.Parallel()
-	extractor := extractor.PNG{}
+	png := extractor.PNG{}
 
 	var (
 		pngHeader         = []byte("\x89\x50\x4E\x47")     // PNG header
@@ -30,8 +41,18 @@ func TestPNG(t *testing.T) {
 		)
 	}
 
+	// Completes the IHDR chunk with 8-bit samples of the given color type and appends the chunks.
+	mergePNGChunks := func(colorType extractor.PNGColorType, chunks ...[]byte) []byte {
+		return mergeBuffers(
+			mergePNG(),
+			[]byte{0x08, byte(colorType), 0x00, 0x00, 0x00},
+			make([]byte, 4), // IHDR CRC
+			mergeBuffers(chunks...),
+		)
+	}
+
 	t.Run("BufferSizeMatchesPNGHeaderLength", func(t *testing.T) {
-		bufSize := extractor.BufSize()
+		bufSize := png.BufSize()
 		expectedBufSize := len(pngHeader)
 
 		if bufSize != expectedBufSize {
@@ -41,7 +62,7 @@ func TestPNG(t *testing.T) {
 
 	t.Run("FormatDetection", func(t *testing.T) {
 		validPNG := mergePNG()
-		format, matched := extractor.MatchFormat(validPNG)
+		format, matched := png.MatchFormat(validPNG)
 		if !matched {
 			t.Error("expected match for valid PNG file")
 		}
@@ -55,7 +76,7 @@ func TestPNG(t *testing.T) {
 	t.Run("ExtractSizeFromValidImage", func(t *testing.T) {
 		validPNG := mergePNG()
 		reader := bytes.NewReader(validPNG)
-		width, height, err := extractor.ExtractSize(reader)
+		width, height, err := png.ExtractSize(reader)
 		if err != nil {
 			t.Fatalf("expected no error, got %v", err)
 		}
@@ -69,6 +90,505 @@ func TestPNG(t *testing.T) {
 		}
 	})
 
+	t.Run("ExtractHeaderFields", func(t *testing.T) {
+		buf := mergeBuffers(
+			mergePNG(),
+			[]byte{0x10, 0x02, 0x00, 0x00, 0x01}, // 16-bit RGB, Adam7 interlaced
+			make([]byte, 4),
+			pngChunk("IEND", nil),
+		)
+
+		info, err := png.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.BitDepth != 16 || info.ColorType != extractor.PNGColorRGB || info.InterlaceMethod != extractor.PNGInterlaceAdam7 {
+			t.Errorf("expected 16-bit RGB with Adam7 interlace, got %d-bit %s with %s interlace",
+				info.BitDepth, info.ColorType, info.InterlaceMethod)
+		}
+
+		if info.HasAlpha() {
+			t.Error("expected no alpha for RGB without tRNS")
+		}
+
+		// The fields are left zero for files ending right after the size
+		info, err = png.ExtractInfo(bytes.NewReader(mergePNG()))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.BitDepth != 0 || info.Width != 1 || info.Height != 2 {
+			t.Errorf("expected 1x2 image without bit depth, got %dx%d with bit depth %d", info.Width, info.Height, info.BitDepth)
+		}
+	})
+
+	t.Run("DetectTransparency", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			buf          []byte
+			transparency bool
+			alpha        bool
+		}{
+			{
+				name:         "PaletteWithTRNS",
+				buf:          mergePNGChunks(extractor.PNGColorPalette, pngChunk("PLTE", make([]byte, 6)), pngChunk("tRNS", []byte{0x00})),
+				transparency: true,
+				alpha:        true,
+			},
+			{
+				name:  "RGBA",
+				buf:   mergePNGChunks(extractor.PNGColorRGBA, pngChunk("IDAT", nil)),
+				alpha: true,
+			},
+			{
+				name: "TRNSAfterIDAT",
+				buf:  mergePNGChunks(extractor.PNGColorRGB, pngChunk("IDAT", nil), pngChunk("tRNS", make([]byte, 6))),
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				info, err := png.ExtractInfo(bytes.NewReader(tt.buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.Transparency != tt.transparency {
+					t.Errorf("expected transparency %v, got %v", tt.transparency, info.Transparency)
+				}
+
+				if info.HasAlpha() != tt.alpha {
+					t.Errorf("expected alpha %v, got %v", tt.alpha, info.HasAlpha())
+				}
+			})
+		}
+	})
+
+	t.Run("ExtractAnimation", func(t *testing.T) {
+		buf, err := os.ReadFile("../_testdata/png/100x100_animated.png")
+		if err != nil {
+			t.Fatalf("failed to read test file: %v", err)
+		}
+
+		info, err := png.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Animation == nil {
+			t.Fatal("expected animation, got nil")
+		}
+
+		expected := extractor.Animation{Frames: 20, LoopCount: 0}
+		if *info.Animation != expected {
+			t.Errorf("expected %+v without duration, got %+v", expected, *info.Animation)
+		}
+
+		// Every frame is shown for 75ms
+		apng := extractor.PNG{TotalDuration: true}
+		info, err = apng.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected.Duration = 1500 * time.Millisecond
+		if *info.Animation != expected {
+			t.Errorf("expected %+v, got %+v", expected, *info.Animation)
+		}
+	})
+
+	t.Run("StillImageIsNotAnimated", func(t *testing.T) {
+		info, err := extractor.PNG{TotalDuration: true}.ExtractInfo(bytes.NewReader(
+			mergePNGChunks(extractor.PNGColorRGB, pngChunk("IDAT", nil), pngChunk("IEND", nil)),
+		))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Animation != nil {
+			t.Errorf("expected no animation, got %+v", *info.Animation)
+		}
+	})
+
+	t.Run("MalformedAnimationChunks", func(t *testing.T) {
+		actl := mergeBuffers(be32(2), be32(0))
+		// Sequence number, size, offsets, a delay of 25/100 second, dispose and blend operations
+		fctl := mergeBuffers(be32(0), be32(1), be32(1), be32(0), be32(0), be16(25), be16(100), []byte{0x00, 0x00})
+
+		// acTL chunks of another length are malformed
+		for _, actl := range [][]byte{actl[:4], mergeBuffers(actl, []byte{0x00})} {
+			info, err := png.ExtractInfo(bytes.NewReader(mergePNGChunks(extractor.PNGColorRGB, pngChunk("acTL", actl), pngChunk("IDAT", nil))))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if info.Animation != nil {
+				t.Errorf("expected no animation from an acTL chunk of %d bytes, got %+v", len(actl), *info.Animation)
+			}
+		}
+
+		// fcTL chunks of another length are skipped without losing the position of the next chunks
+		apng := extractor.PNG{TotalDuration: true}
+		info, err := apng.ExtractInfo(bytes.NewReader(mergePNGChunks(extractor.PNGColorRGB,
+			pngChunk("acTL", actl), pngChunk("fcTL", fctl[:8]), pngChunk("IDAT", nil),
+			pngChunk("fcTL", mergeBuffers(fctl, []byte{0x00})), pngChunk("fcTL", fctl), pngChunk("IEND", nil),
+		)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := extractor.Animation{Frames: 2, Duration: 250 * time.Millisecond}
+		if info.Animation == nil || *info.Animation != expected {
+			t.Errorf("expected %+v, got %+v", expected, info.Animation)
+		}
+	})
+
+	t.Run("ExtractResolution", func(t *testing.T) {
+		// 2835 pixels per meter is 72 DPI, rounded
+		phys := mergeBuffers(be32(2835), be32(2835), []byte{0x01})
+
+		info, err := png.ExtractInfo(bytes.NewReader(mergePNGChunks(extractor.PNGColorRGB, pngChunk("pHYs", phys))))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.ResolutionSource != extractor.ResolutionPHYs || math.Round(info.XDPI) != 72 || math.Round(info.YDPI) != 72 {
+			t.Errorf("expected 72 DPI from pHYs, got %vx%v from %s", info.XDPI, info.YDPI, info.ResolutionSource)
+		}
+
+		if math.Abs(info.HeightMillimeters()-2*25.4/info.YDPI) > 1e-9 {
+			t.Errorf("expected height of %v mm, got %v", 2*25.4/info.YDPI, info.HeightMillimeters())
+		}
+
+		// Densities without unit only give the pixel aspect ratio
+		aspectOnly := mergeBuffers(be32(1), be32(2), []byte{0x00})
+		info, err = png.ExtractInfo(bytes.NewReader(mergePNGChunks(extractor.PNGColorRGB, pngChunk("pHYs", aspectOnly))))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XDPI != 0 || info.PixelAspectRatio != 2 || info.WidthInches != 0 {
+			t.Errorf("expected pixel aspect ratio 2 without DPI, got %+v", info.Resolution)
+		}
+
+		// pHYs chunks of another length are malformed
+		for _, phys := range [][]byte{phys[:8], mergeBuffers(phys, []byte{0x00})} {
+			info, err = png.ExtractInfo(bytes.NewReader(mergePNGChunks(extractor.PNGColorRGB, pngChunk("pHYs", phys), pngChunk("IDAT", nil))))
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if info.ResolutionSource != extractor.ResolutionUnknown {
+				t.Errorf("expected no resolution from a pHYs chunk of %d bytes, got %+v", len(phys), info.Resolution)
+			}
+		}
+	})
+
+	t.Run("ExtractEXIFOrientation", func(t *testing.T) {
+		exif := tiffBlock(binary.BigEndian,
+			[]tiffTestEntry{tiffShort(binary.BigEndian, 0x0112, uint16(extractor.OrientationRotate270))},
+		)
+
+		buf := mergePNGChunks(extractor.PNGColorRGBA,
+			pngChunk("gAMA", be32(45455)),
+			pngChunk("eXIf", exif),
+			pngChunk("IDAT", nil),
+		)
+
+		info, err := png.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Orientation != extractor.OrientationRotate270 {
+			t.Errorf("expected orientation %d, got %d", extractor.OrientationRotate270, info.Orientation)
+		}
+
+		if info.DisplayWidth != 2 || info.DisplayHeight != 1 {
+			t.Errorf("expected display size 2x1, got %dx%d", info.DisplayWidth, info.DisplayHeight)
+		}
+
+		// eXIf chunks after the image data are not read
+		afterIDAT := mergePNGChunks(extractor.PNGColorRGBA, pngChunk("IDAT", nil), pngChunk("eXIf", exif))
+
+		info, err = png.ExtractInfo(bytes.NewReader(afterIDAT))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Orientation != extractor.OrientationUnknown {
+			t.Errorf("expected unknown orientation, got %d", info.Orientation)
+		}
+	})
+
+	t.Run("ExtractAppleOptimizedImage", func(t *testing.T) {
+		buf := mergeBuffers(
+			pngHeader,
+			pngSequenceHeader,
+			pngChunk("CgBI", []byte{0x50, 0x00, 0x20, 0x06}),
+			ihdrLengthHeader,
+			ihdrHeader,
+			pngWidth, pngHeight,
+			[]byte{0x08, 0x06, 0x00, 0x00, 0x00},
+			make([]byte, 4),
+			pngChunk("IDAT", nil),
+		)
+
+		info, err := png.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !info.AppleOptimized {
+			t.Error("expected Apple optimized image")
+		}
+
+		if info.Width != 1 || info.Height != 2 || info.ColorType != extractor.PNGColorRGBA {
+			t.Errorf("expected 1x2 RGBA image, got %dx%d %s", info.Width, info.Height, info.ColorType)
+		}
+	})
+
+	t.Run("ReadColorProfile", func(t *testing.T) {
+		icc := iccProfile("desc", "Display P3")
+
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		if _, err := writer.Write(icc); err != nil {
+			t.Fatalf("failed to compress profile: %v", err)
+		}
+		writer.Close()
+
+		chromaticities := mergeBuffers(be32(31270), be32(32900), be32(64000), be32(33000), be32(30000), be32(60000), be32(15000), be32(6000))
+
+		tests := []struct {
+			name   string
+			chunks [][]byte
+			check  func(t *testing.T, profile *extractor.ColorProfile)
+		}{
+			{
+				name: "ICCProfile",
+				chunks: [][]byte{
+					pngChunk("cHRM", chromaticities),
+					pngChunk("iCCP", mergeBuffers([]byte("Display P3\x00\x00"), compressed.Bytes())),
+				},
+				check: func(t *testing.T, profile *extractor.ColorProfile) {
+					if !bytes.Equal(profile.ICC, icc) || profile.Description != "Display P3" || profile.ColorSpace != "RGB" {
+						t.Errorf("expected the Display P3 profile, got %q %q", profile.ColorSpace, profile.Description)
+					}
+
+					// The colorants of the profile supersede the cHRM chunk
+					if profile.Primaries == nil || math.Abs(profile.Primaries.Red.X-0.6485) > 1e-3 {
+						t.Errorf("expected the primaries of the profile, got %+v", profile.Primaries)
+					}
+				},
+			},
+			{
+				name: "SRGBAndGamma",
+				chunks: [][]byte{
+					pngChunk("sRGB", []byte{0x01}),
+					pngChunk("gAMA", be32(45455)),
+					pngChunk("cHRM", chromaticities),
+				},
+				check: func(t *testing.T, profile *extractor.ColorProfile) {
+					if !profile.SRGB || profile.RenderingIntent != 1 || profile.Gamma != 0.45455 || profile.ICC != nil {
+						t.Errorf("expected sRGB with relative colorimetric intent and gamma 0.45455, got %+v", profile)
+					}
+
+					expected := extractor.Primaries{
+						Red:   extractor.Chromaticity{X: 0.64, Y: 0.33},
+						Green: extractor.Chromaticity{X: 0.3, Y: 0.6},
+						Blue:  extractor.Chromaticity{X: 0.15, Y: 0.06},
+						White: extractor.Chromaticity{X: 0.3127, Y: 0.329},
+					}
+					if profile.Primaries == nil || *profile.Primaries != expected {
+						t.Errorf("expected primaries %+v, got %+v", expected, profile.Primaries)
+					}
+				},
+			},
+			{
+				name:   "CodingIndependentCodePoints",
+				chunks: [][]byte{pngChunk("cICP", []byte{9, 16, 0, 1})},
+				check: func(t *testing.T, profile *extractor.ColorProfile) {
+					expected := extractor.CICP{ColorPrimaries: 9, TransferCharacteristics: 16, FullRange: true}
+					if profile.CICP == nil || *profile.CICP != expected || profile.CICP.PrimariesName() != "BT.2020" {
+						t.Errorf("expected BT.2020 PQ code points %+v, got %+v", expected, profile.CICP)
+					}
+				},
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				buf := mergePNGChunks(extractor.PNGColorRGB, append(tt.chunks, pngChunk("IDAT", nil))...)
+
+				info, err := extractor.PNG{ReadColorProfile: true}.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.ColorProfile == nil {
+					t.Fatal("expected color profile, got nil")
+				}
+				tt.check(t, info.ColorProfile)
+
+				info, err = png.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.ColorProfile != nil {
+					t.Errorf("expected no color profile unless requested, got %+v", info.ColorProfile)
+				}
+			})
+		}
+	})
+
+	t.Run("ReadXMP", func(t *testing.T) {
+		packet := xmpPacket(`xmp:Rating="3"`, "")
+
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		if _, err := writer.Write(packet); err != nil {
+			t.Fatalf("failed to compress packet: %v", err)
+		}
+		writer.Close()
+
+		tests := []struct {
+			name  string
+			chunk []byte
+		}{
+			{name: "Uncompressed", chunk: pngChunk("iTXt", mergeBuffers([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), packet))},
+			{name: "Compressed", chunk: pngChunk("iTXt", mergeBuffers([]byte("XML:com.adobe.xmp\x00\x01\x00\x00\x00"), compressed.Bytes()))},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				other := pngChunk("iTXt", []byte("Comment\x00\x00\x00en\x00Kommentar\x00Hello"))
+				buf := mergePNGChunks(extractor.PNGColorRGB, other, tt.chunk, pngChunk("IDAT", nil))
+
+				info, err := extractor.PNG{ReadXMP: true}.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.XMP == nil || !bytes.Equal(info.XMP.Packet, packet) || info.XMP.Properties["xmp:Rating"] != "3" {
+					t.Errorf("expected the packet of the iTXt chunk, got %+v", info.XMP)
+				}
+
+				info, err = png.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if info.XMP != nil {
+					t.Errorf("expected no XMP unless requested, got %+v", info.XMP)
+				}
+			})
+		}
+	})
+
+	t.Run("ReadText", func(t *testing.T) {
+		deflate := func(data string) []byte {
+			var compressed bytes.Buffer
+			writer := zlib.NewWriter(&compressed)
+			writer.Write([]byte(data))
+			writer.Close()
+			return compressed.Bytes()
+		}
+
+		parameters := "a cat, Steps: 20, Sampler: Euler a"
+		buf := mergePNGChunks(extractor.PNGColorRGB,
+			pngChunk("tEXt", []byte("Author\x00Jos\xe9")),
+			pngChunk("zTXt", mergeBuffers([]byte("parameters\x00\x00"), deflate(parameters))),
+			pngChunk("iTXt", mergeBuffers([]byte("Title\x00\x01\x00fr\x00Titre\x00"), deflate("Caf\u00e9"))),
+			pngChunk("tEXt", []byte("\x00No keyword")),
+			pngChunk("IDAT", nil),
+			pngChunk("tEXt", []byte("Comment\x00After image data")),
+			pngChunk("IEND", nil),
+		)
+
+		before := []extractor.PNGText{
+			{Chunk: "tEXt", Keyword: "Author", Text: "Jos\u00e9"},
+			{Chunk: "zTXt", Keyword: "parameters", Text: parameters, Compressed: true},
+			{Chunk: "iTXt", Keyword: "Title", Text: "Caf\u00e9", Compressed: true, Language: "fr", TranslatedKeyword: "Titre"},
+		}
+
+		tests := []struct {
+			name      string
+			extractor extractor.PNG
+			expected  []extractor.PNGText
+		}{
+			{name: "BeforeImageData", extractor: extractor.PNG{ReadText: true}, expected: before},
+			{
+				name:      "WholeFile",
+				extractor: extractor.PNG{ReadText: true, TextAfterImageData: true},
+				expected:  append(before, extractor.PNGText{Chunk: "tEXt", Keyword: "Comment", Text: "After image data"}),
+			},
+			{name: "NotRequested", extractor: png},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				info, err := tt.extractor.ExtractInfo(bytes.NewReader(buf))
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				if len(info.Text) != len(tt.expected) {
+					t.Fatalf("expected %d text entries, got %+v", len(tt.expected), info.Text)
+				}
+				for i, text := range tt.expected {
+					if info.Text[i] != text {
+						t.Errorf("expected text entry %d to be %+v, got %+v", i, text, info.Text[i])
+					}
+				}
+			})
+		}
+
+		// Text exceeding the size limit once decompressed is ignored
+		large := mergePNGChunks(extractor.PNGColorRGB,
+			pngChunk("zTXt", mergeBuffers([]byte("Comment\x00\x00"), deflate(strings.Repeat("a", 2<<20)))),
+			pngChunk("IDAT", nil),
+		)
+
+		info, err := extractor.PNG{ReadText: true}.ExtractInfo(bytes.NewReader(large))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Text != nil {
+			t.Errorf("expected no text entry past the size limit, got %d entries", len(info.Text))
+		}
+
+		// Chunks exceeding the size limit are skipped without being read
+		chunk := mergeBuffers([]byte("Comment\x00"), bytes.Repeat([]byte("a"), 2<<20))
+		reader := &countingReader{ReadSeeker: bytes.NewReader(mergePNGChunks(extractor.PNGColorRGB, pngChunk("tEXt", chunk), pngChunk("IDAT", nil)))}
+		if info, err = (extractor.PNG{ReadText: true, ReadXMP: true}).ExtractInfo(reader); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Text != nil || reader.read > len(chunk)/2 {
+			t.Errorf("expected the chunk past the size limit to be skipped, got %d entries and %d bytes read", len(info.Text), reader.read)
+		}
+	})
+
+	t.Run("IHDRIsNotFirstChunk", func(t *testing.T) {
+		buf := mergeBuffers(
+			pngHeader,
+			pngSequenceHeader,
+			pngChunk("gAMA", be32(45455)),
+			ihdrLengthHeader,
+			ihdrHeader,
+			pngWidth, pngHeight,
+		)
+
+		_, _, err := png.ExtractSize(bytes.NewReader(buf))
+		if err == nil || !strings.Contains(err.Error(), "IHDR") {
+			t.Fatalf("expected error about IHDR not being the first chunk, got %v", err)
+		}
+	})
+
 	t.Run("CorruptedImage_IHDR", func(t *testing.T) {
 		invalidPNG := mergeBuffers(
 			pngHeader,
@@ -78,7 +598,7 @@ func TestPNG(t *testing.T) {
 		)
 
 		reader := bytes.NewReader(invalidPNG)
-		_, _, err := extractor.ExtractSize(reader)
+		_, _, err := png.ExtractSize(reader)
 
 		if err == nil {
 			t.Fatalf("expected error due to missing IHDR header, got nil")
@@ -87,7 +607,7 @@ func TestPNG(t *testing.T) {
 
 	t.Run("InvalidImageFormatDetection", func(t *testing.T) {
 		nonPNG := []byte("NOTPNGHEADER")
-		_, matched := extractor.MatchFormat(nonPNG)
+		_, matched := png.MatchFormat(nonPNG)
 
 		if matched {
 			t.Error("expected no match for non-PNG file")
@@ -0,0 +1,140 @@
+package extractor
+
+import "math"
+
+// ResolutionSource tells where the resolution of an image was read from.
+type ResolutionSource uint8
+
+const (
+	// ResolutionUnknown means that the image carries no resolution.
+	ResolutionUnknown ResolutionSource = iota
+
+	// ResolutionPHYs is the pHYs chunk of PNG images.
+	ResolutionPHYs
+
+	// ResolutionJFIF is the density of the JFIF APP0 segment of JPEG images.
+	ResolutionJFIF
+
+	// ResolutionEXIF is the XResolution, YResolution and ResolutionUnit TIFF tags of EXIF data.
+	ResolutionEXIF
+)
+
+func (s ResolutionSource) String() string {
+	switch s {
+	case ResolutionPHYs:
+		return "pHYs"
+	case ResolutionJFIF:
+		return "JFIF"
+	case ResolutionEXIF:
+		return "EXIF"
+	default:
+		return "unknown"
+	}
+}
+
+const millimetersPerInch = 25.4
+
+// Units of pixel densities.
+type densityUnit uint8
+
+const (
+	// The densities only give the pixel aspect ratio
+	densityAspectOnly densityUnit = iota
+	densityPerInch
+	densityPerCentimeter
+	densityPerMeter
+)
+
+// Resolution is embedded in the details of the formats that can carry a physical resolution.
+type Resolution struct {
+	// Pixels per inch, 0 if unknown or if the source only gives the pixel aspect ratio.
+	XDPI float64
+	YDPI float64
+
+	// Width to height ratio of a pixel, 1 for square pixels, 0 if unknown.
+	PixelAspectRatio float64
+
+	// Source the resolution was read from.
+	ResolutionSource ResolutionSource
+
+	// ResolutionConflict reports that another source, such as EXIF data along with a JFIF segment,
+	// gives a different DPI than ResolutionSource.
+	ResolutionConflict bool
+
+	// Physical size of the image in inches once displayed, 0 if the DPI is unknown.
+	WidthInches  float64
+	HeightInches float64
+}
+
+// PhysicalResolution returns the resolution, regardless of the details embedding it.
+func (r Resolution) PhysicalResolution() Resolution {
+	return r
+}
+
+// WidthMillimeters returns the physical width of the image in millimeters, 0 if the DPI is unknown.
+func (r Resolution) WidthMillimeters() float64 {
+	return r.WidthInches * millimetersPerInch
+}
+
+// HeightMillimeters returns the physical height of the image in millimeters, 0 if the DPI is unknown.
+func (r Resolution) HeightMillimeters() float64 {
+	return r.HeightInches * millimetersPerInch
+}
+
+// Creates a resolution from horizontal and vertical pixel densities, ignoring invalid densities.
+func newResolution(source ResolutionSource, x, y float64, unit densityUnit) Resolution {
+	if !(x > 0 && y > 0) || math.IsInf(x, 0) || math.IsInf(y, 0) {
+		return Resolution{}
+	}
+
+	resolution := Resolution{
+		PixelAspectRatio: y / x,
+		ResolutionSource: source,
+	}
+
+	switch unit {
+	case densityPerInch:
+		resolution.XDPI, resolution.YDPI = x, y
+	case densityPerCentimeter:
+		resolution.XDPI, resolution.YDPI = x*2.54, y*2.54
+	case densityPerMeter:
+		resolution.XDPI, resolution.YDPI = x*0.0254, y*0.0254
+	}
+	return resolution
+}
+
+// Picks the first candidate giving a DPI, or else the first giving a pixel aspect ratio,
+// and computes the physical size of the image once displayed. Densities apply to the stored image,
+// so they are swapped along with its dimensions for orientations that rotate it by 90 degrees.
+func resolveResolution(size OrientedSize, candidates ...Resolution) Resolution {
+	var resolved Resolution
+	for _, candidate := range candidates {
+		switch {
+		case candidate.ResolutionSource == ResolutionUnknown:
+			continue
+		case resolved.ResolutionSource == ResolutionUnknown:
+			resolved = candidate
+		case resolved.XDPI == 0 && candidate.XDPI > 0:
+			resolved = candidate
+		case resolved.XDPI > 0 && candidate.XDPI > 0:
+			resolved.ResolutionConflict = resolved.ResolutionConflict ||
+				!similarDensity(resolved.XDPI, candidate.XDPI) || !similarDensity(resolved.YDPI, candidate.YDPI)
+		}
+	}
+
+	if resolved.XDPI > 0 {
+		xDPI, yDPI := resolved.XDPI, resolved.YDPI
+		if size.Orientation.SwapsDimensions() {
+			xDPI, yDPI = yDPI, xDPI
+		}
+		resolved.WidthInches = float64(size.DisplayWidth) / xDPI
+		resolved.HeightInches = float64(size.DisplayHeight) / yDPI
+	}
+	return resolved
+}
+
+// Compares densities with a tolerance of 1%, as converting between units rounds them,
+// e.g. 72 DPI is stored as 2835 pixels per meter in PNG files.
+func similarDensity(a, b float64) bool {
+	return math.Abs(a-b) <= 0.01*math.Max(a, b)
+}
@@ -2,9 +2,12 @@ package extractor
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"image/color"
 	"io"
+	"time"
 
 	"github.com/pillowskiy/imagesize/imagebytes"
 	"github.com/pillowskiy/imagesize/imagerrors"
@@ -15,6 +18,116 @@ var webpHeader = []byte("WEBP")
 // Skip RIFF and File Size headers
 var skipBytesCount = 4 + 4
 
+const (
+	// Offset of the VP8X flags and of the chunk following VP8X: RIFF header (12), VP8X header (8) and data (10).
+	vp8xFlagsOffset     = 20
+	vp8xNextChunkOffset = 30
+)
+
+// VP8X flags.
+const (
+	vp8xAnimationFlag byte = 0x02
+	vp8xXMPFlag       byte = 0x04
+	vp8xExifFlag      byte = 0x08
+	vp8xAlphaFlag     byte = 0x10
+	vp8xICCFlag       byte = 0x20
+)
+
+// WEBPBitstreamError reports a VP8 or VP8L bitstream header that does not match the specification.
+type WEBPBitstreamError struct {
+	// Chunk of the bitstream, "VP8 " or "VP8L".
+	Chunk string
+
+	// Field of the header, e.g. "start code" or "signature".
+	Field string
+
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *WEBPBitstreamError) Error() string {
+	return fmt.Sprintf("invalid %q bitstream: %s is %#x, expected %#x", e.Chunk, e.Field, e.Actual, e.Expected)
+}
+
+const (
+	vp8StartCode     = 0x9D012A
+	vp8lSignature    = 0x2F
+	vp8DimensionMask = 0x3FFF
+)
+
+// WEBPFeatures are the features announced by the flags of the VP8X chunk.
+type WEBPFeatures struct {
+	ICC       bool
+	Alpha     bool
+	EXIF      bool
+	XMP       bool
+	Animation bool
+}
+
+// WEBPFrame describes a frame of an animated WebP file (ANMF chunk).
+type WEBPFrame struct {
+	// Position and size of the frame on the canvas.
+	X      int
+	Y      int
+	Width  int
+	Height int
+
+	Duration time.Duration
+
+	// Blend reports that the frame is alpha-blended with the canvas, instead of overwriting it.
+	Blend bool
+
+	// Dispose reports that the frame area is cleared to the background color before the next frame.
+	Dispose bool
+}
+
+// WEBPAnimation describes the playback of an animated WebP file (ANIM and ANMF chunks).
+type WEBPAnimation struct {
+	Animation
+
+	// Background color of the canvas, which players may ignore.
+	BackgroundColor color.NRGBA
+
+	// Position, size and duration of each frame, in display order.
+	FrameInfo []WEBPFrame
+}
+
+// WEBPInfo contains the information extracted from a WebP file.
+type WEBPInfo struct {
+	// Size of the image, or of the canvas for extended (VP8X) files.
+	Width  int
+	Height int
+
+	// Upscaling of lossy (VP8) images on display: 0 for none, 1 for 5/4, 2 for 5/3 and 3 for 2.
+	// Width and Height are the size before upscaling, as decoders leave it to the application.
+	HorizontalScale uint8
+	VerticalScale   uint8
+
+	// Features announced by extended (VP8X) files, zero for simple files.
+	Features WEBPFeatures
+
+	// Alpha reports an ALPH chunk, which carries the alpha channel of lossy (VP8) images.
+	// Lossless (VP8L) images have their alpha channel in the bitstream.
+	Alpha bool
+
+	// Animation of extended files announcing it, nil otherwise.
+	// Its frames and duration are only known with WEBP.ReadFrames.
+	Animation *WEBPAnimation
+
+	// Orientation from the EXIF chunk of extended (VP8X) files, if any.
+	OrientedSize
+
+	// Resolution from the EXIF chunk, WebP has no resolution of its own.
+	Resolution
+
+	// ICC profile of the ICCP chunk, read with WEBP.ReadColorProfile. Nil otherwise or when the file has none.
+	ColorProfile *ColorProfile
+
+	// XMP packet of the "XMP " chunk, or else of the EXIF chunk, read with WEBP.ReadXMP.
+	// Nil otherwise or when the file has none.
+	XMP *XMP
+}
+
 // WEBP defines an extractor for WebP image format.
 //
 // The WebP file format starts with a RIFF-based structure:
@@ -24,7 +137,17 @@ var skipBytesCount = 4 + 4
 // 4. The next 4 bytes specify the WebP encoding format ("VP8 ", "VP8L", "VP8X")
 //
 // Together, these 16 bytes form the mandatory WebP header.
-type WEBP struct{}
+type WEBP struct {
+	// ReadFrames walks the ANMF chunks of animated files to report their frames and duration,
+	// along with the ALPH chunks of the frames.
+	ReadFrames bool
+
+	// ReadColorProfile reads the ICCP chunk of extended (VP8X) files, see WEBPInfo.ColorProfile.
+	ReadColorProfile bool
+
+	// ReadXMP reads the "XMP " chunk of extended (VP8X) files, see WEBPInfo.XMP.
+	ReadXMP bool
+}
 
 func (e WEBP) BufSize() int {
 	return skipBytesCount + len(webpHeader)
@@ -35,66 +158,312 @@ func (e WEBP) MatchFormat(buf []byte) (string, bool) {
 }
 
 func (e WEBP) ExtractSize(reader io.ReadSeeker) (width, height int, err error) {
+	info, err := e.ExtractInfo(reader)
+	if err != nil {
+		return
+	}
+
+	return info.Width, info.Height, nil
+}
+
+// ExtractDetails implements imagesize.DetailsExtractor, the details are of type *WEBPInfo.
+func (e WEBP) ExtractDetails(reader io.ReadSeeker) (width, height int, details interface{}, err error) {
+	info, err := e.ExtractInfo(reader)
+	if err != nil {
+		return
+	}
+
+	return info.Width, info.Height, info, nil
+}
+
+// ExtractInfo extracts the size from the first chunk and, for extended files,
+// walks the following chunks for animation (ANIM, ANMF), alpha (ALPH) and orientation (EXIF).
+func (e WEBP) ExtractInfo(reader io.ReadSeeker) (*WEBPInfo, error) {
 	// Skip RIFF, FileSize and WEBP headers
 	var skipBytes int64 = int64(skipBytesCount + len(webpHeader))
-	if _, err = reader.Seek(skipBytes, io.SeekStart); err != nil {
-		err = fmt.Errorf("failed to seek to correct position: %w", err)
-		return
+	if _, err := reader.Seek(skipBytes, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to correct position: %w", err)
 	}
 
 	var buffer [4]byte
 	// Read the VP8 Tag ("VP8 ", "VP8L", "VP8X")
-	if _, err = reader.Read(buffer[:]); err != nil {
-		err = fmt.Errorf("failed to read buffer: %w", err)
-		return
+	if _, err := reader.Read(buffer[:]); err != nil {
+		return nil, fmt.Errorf("failed to read buffer: %w", err)
 	}
 
+	info := new(WEBPInfo)
+	var err error
+	var exif []byte
 	switch buffer[3] {
 	case ' ':
-		return e.webpVp8Size(reader)
+		err = e.webpVp8Size(reader, info)
 	case 'L':
-		return e.webpVp8lSize(reader)
+		info.Width, info.Height, err = e.webpVp8lSize(reader)
 	case 'X':
-		return e.webpVp8xSize(reader)
+		if info.Width, info.Height, err = e.webpVp8xSize(reader); err == nil {
+			exif, err = e.readExtendedChunks(reader, info)
+		}
 	default:
 		err = errors.New("unknown VP8 tag")
-		return
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	exifData := openEXIF(exif)
+	info.OrientedSize = orientedSize(exifData, info.Width, info.Height)
+	info.Resolution = resolveResolution(info.OrientedSize, exifResolution(exifData))
+
+	if e.ReadXMP && info.XMP == nil && exifData != nil {
+		if packet := exifData.xmp(); packet != nil {
+			info.XMP = newXMP(packet)
+		}
+	}
+	return info, nil
 }
 
-// The WebP VP8 format stores the width and height as unsigned 16-bit integers at byte offsets 26 and 28
-// in the image data (little-endian format). The function seeks to the appropriate position in the file,
-// reads the width and height, and returns them.
-func (e WEBP) webpVp8Size(reader io.ReadSeeker) (width, height int, err error) {
-	if _, err = reader.Seek(26, io.SeekStart); err != nil {
-		err = fmt.Errorf("failed to seek: %w", err)
+// Reads the VP8X flags and walks the chunks following VP8X until the chunks of interest announced
+// by the flags are read, EXIF and XMP usually following the image data. Returns the EXIF chunk, if any.
+// A file ending early is not an error, as only the VP8X chunk is needed for the size.
+func (e WEBP) readExtendedChunks(reader io.ReadSeeker, info *WEBPInfo) ([]byte, error) {
+	if _, err := reader.Seek(vp8xFlagsOffset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to VP8X flags: %w", err)
+	}
+
+	var flags [1]byte
+	if _, err := io.ReadFull(reader, flags[:]); err != nil {
+		return nil, fmt.Errorf("failed to read VP8X flags: %w", err)
+	}
+
+	info.Features = WEBPFeatures{
+		ICC:       flags[0]&vp8xICCFlag != 0,
+		Alpha:     flags[0]&vp8xAlphaFlag != 0,
+		EXIF:      flags[0]&vp8xExifFlag != 0,
+		XMP:       flags[0]&vp8xXMPFlag != 0,
+		Animation: flags[0]&vp8xAnimationFlag != 0,
+	}
+	readICC := info.Features.ICC && e.ReadColorProfile
+	readXMP := info.Features.XMP && e.ReadXMP
+	if info.Features.Animation {
+		info.Animation = new(WEBPAnimation)
+	}
+
+	// ALPH and ANIM precede the image data, the walk stops once the chunks of interest are read
+	wantAlpha := info.Features.Alpha && !info.Features.Animation
+	wantAnimation := info.Features.Animation
+	wantFrames := info.Features.Animation && e.ReadFrames
+
+	var exif []byte
+	pending := func() bool {
+		return wantAlpha || wantAnimation || wantFrames ||
+			(info.Features.EXIF && exif == nil) || (readICC && info.ColorProfile == nil) || (readXMP && info.XMP == nil)
+	}
+
+	offset := int64(vp8xNextChunkOffset)
+	for pending() {
+		fourCC, size, err := e.readChunkHeader(reader, offset)
+		if err != nil {
+			if isEOF(err) {
+				return exif, nil
+			}
+			return nil, err
+		}
+
+		switch fourCC {
+		case "ALPH":
+			info.Alpha, wantAlpha = true, false
+		case "VP8 ", "VP8L":
+			wantAlpha = false
+		case "ANIM":
+			if info.Animation == nil {
+				break
+			}
+			if err := e.readAnimation(reader, info.Animation); err != nil {
+				return nil, err
+			}
+			wantAnimation = false
+		case "ANMF":
+			wantAnimation = false
+			if !wantFrames {
+				break
+			}
+			if err := e.readFrame(reader, size, info); err != nil {
+				return nil, err
+			}
+		case "EXIF":
+			if exif != nil || size > maxEXIFSize {
+				break
+			}
+
+			buf := make([]byte, size)
+			if _, err := io.ReadFull(reader, buf); err == nil {
+				exif = buf
+			}
+		case "ICCP":
+			if !readICC || info.ColorProfile != nil || size > maxICCSize {
+				break
+			}
+
+			icc := make([]byte, size)
+			if _, err := io.ReadFull(reader, icc); err != nil {
+				return nil, fmt.Errorf("failed to read ICCP chunk: %w", err)
+			}
+			info.ColorProfile = newICCColorProfile(icc)
+		case "XMP ":
+			if !readXMP || info.XMP != nil || size > maxXMPSize {
+				break
+			}
+
+			packet := make([]byte, size)
+			if _, err := io.ReadFull(reader, packet); err != nil {
+				return nil, fmt.Errorf("failed to read XMP chunk: %w", err)
+			}
+			info.XMP = newXMP(packet)
+		}
+
+		// Chunks are padded to an even size
+		offset += 8 + int64(size) + int64(size&1)
+	}
+	return exif, nil
+}
+
+// Reads the FourCC and size of the chunk at the given offset, leaving the reader at its data.
+func (e WEBP) readChunkHeader(reader io.ReadSeeker, offset int64) (fourCC string, size uint32, err error) {
+	if _, err = reader.Seek(offset, io.SeekStart); err != nil {
+		err = fmt.Errorf("failed to seek to chunk: %w", err)
 		return
 	}
 
-	widthU16, widthErr := imagebytes.ReadU16(reader, imagebytes.LittleEndian)
-	heightU16, heightErr := imagebytes.ReadU16(reader, imagebytes.LittleEndian)
-	return int(widthU16), int(heightU16), imagerrors.Join(widthErr, heightErr)
+	// Chunk FourCC (4) and size (4)
+	var header [8]byte
+	if _, err = io.ReadFull(reader, header[:]); err != nil {
+		err = fmt.Errorf("failed to read chunk header: %w", err)
+		return
+	}
+
+	return string(header[:4]), binary.LittleEndian.Uint32(header[4:]), nil
+}
+
+// Reads the ANIM chunk: background color (4, in blue, green, red, alpha order) and loop count (2, 0 meaning infinitely).
+func (e WEBP) readAnimation(reader io.Reader, animation *WEBPAnimation) error {
+	var data [6]byte
+	if _, err := io.ReadFull(reader, data[:]); err != nil {
+		return fmt.Errorf("failed to read ANIM chunk: %w", err)
+	}
+
+	animation.BackgroundColor = color.NRGBA{B: data[0], G: data[1], R: data[2], A: data[3]}
+	animation.LoopCount = int(binary.LittleEndian.Uint16(data[4:]))
+	return nil
+}
+
+// Reads the header of an ANMF chunk: X and Y offsets divided by 2 (3 each), width and height minus 1 (3 each),
+// duration in milliseconds (3) and flags (1). The frame data follows, starting with an ALPH chunk for lossy frames with alpha.
+func (e WEBP) readFrame(reader io.Reader, size uint32, info *WEBPInfo) error {
+	if size < 16 {
+		return errors.New("corrupted image: ANMF chunk is too small")
+	}
+
+	var data [16 + 4]byte
+	header := data[:16]
+	if size >= uint32(len(data)) {
+		header = data[:]
+	}
+
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("failed to read ANMF chunk: %w", err)
+	}
+
+	frame := WEBPFrame{
+		X:        int(readU24LE(data[0:3])) * 2,
+		Y:        int(readU24LE(data[3:6])) * 2,
+		Width:    int(readU24LE(data[6:9])) + 1,
+		Height:   int(readU24LE(data[9:12])) + 1,
+		Duration: time.Duration(readU24LE(data[12:15])) * time.Millisecond,
+		Blend:    data[15]&0x02 == 0,
+		Dispose:  data[15]&0x01 != 0,
+	}
+
+	if string(header[16:]) == "ALPH" {
+		info.Alpha = true
+	}
+
+	animation := info.Animation
+	animation.FrameInfo = append(animation.FrameInfo, frame)
+	animation.Frames = len(animation.FrameInfo)
+	animation.Duration += frame.Duration
+	return nil
 }
 
-// The WebP VP8L format stores the width and height as packed data in a single 32-bit integer at byte offset 21.
-// The lower 14 bits represent the width and the upper 14 bits represent the height (little-endian format).
-// The function seeks to the appropriate position in the file, reads the 32-bit integer, and extracts the width and height.
+func readU24LE(buf []byte) uint32 {
+	return uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16
+}
+
+// The WebP VP8 format starts the image data at byte offset 20 with the frame header of a key frame:
+// a 3-byte frame tag whose lowest bit is 0 for key frames, the 9D 01 2A start code, then the width and height
+// as unsigned 16-bit integers at byte offsets 26 and 28 (little-endian format). The lower 14 bits hold the
+// dimension and the upper 2 bits the upscaling factor.
+// See https://datatracker.ietf.org/doc/html/rfc6386#section-9.1
+func (e WEBP) webpVp8Size(reader io.ReadSeeker, info *WEBPInfo) error {
+	if _, err := reader.Seek(20, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek: %w", err)
+	}
+
+	var header [10]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		return fmt.Errorf("failed to read frame header: %w", err)
+	}
+
+	if keyFrame := uint32(header[0] & 0x01); keyFrame != 0 {
+		return &WEBPBitstreamError{Chunk: "VP8 ", Field: "key frame flag", Expected: 0, Actual: keyFrame}
+	}
+
+	if startCode := uint32(header[3])<<16 | uint32(header[4])<<8 | uint32(header[5]); startCode != vp8StartCode {
+		return &WEBPBitstreamError{Chunk: "VP8 ", Field: "start code", Expected: vp8StartCode, Actual: startCode}
+	}
+
+	width := binary.LittleEndian.Uint16(header[6:8])
+	height := binary.LittleEndian.Uint16(header[8:10])
+	info.Width, info.Height = int(width&vp8DimensionMask), int(height&vp8DimensionMask)
+	info.HorizontalScale, info.VerticalScale = uint8(width>>14), uint8(height>>14)
+	return nil
+}
+
+// The WebP VP8L format starts the image data at byte offset 20 with the 0x2F signature, followed by
+// the width and height packed in a single 32-bit integer at byte offset 21 (little-endian format).
+// The lower 14 bits represent the width and the next 14 bits represent the height, followed by
+// the alpha_is_used bit and a 3-bit version that must be 0.
+// The function validates the signature and version, and extracts the width and height.
 // See https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
 func (e WEBP) webpVp8lSize(reader io.ReadSeeker) (width, height int, err error) {
-	if _, err = reader.Seek(21, io.SeekStart); err != nil {
+	if _, err = reader.Seek(20, io.SeekStart); err != nil {
 		err = fmt.Errorf("failed to seek: %w", err)
 		return
 	}
 
+	signature, err := imagebytes.ReadU8(reader)
+	if err != nil {
+		err = fmt.Errorf("failed to read signature: %w", err)
+		return
+	}
+	if signature != vp8lSignature {
+		err = &WEBPBitstreamError{Chunk: "VP8L", Field: "signature", Expected: vp8lSignature, Actual: uint32(signature)}
+		return
+	}
+
 	dims, err := imagebytes.ReadU32(reader, imagebytes.LittleEndian)
 	if err != nil {
 		err = fmt.Errorf("failed to read dimensions: %w", err)
 		return
 	}
 
+	if version := dims >> 29; version != 0 {
+		err = &WEBPBitstreamError{Chunk: "VP8L", Field: "version", Expected: 0, Actual: version}
+		return
+	}
+
 	// Extract the width and height from the 32-bit integer (packed format).
-	width = int(dims&0x3FFF) + 1
-	height = int((dims>>14)&0x3FFF) + 1
+	width = int(dims&vp8DimensionMask) + 1
+	height = int((dims>>14)&vp8DimensionMask) + 1
 	return
 }
 
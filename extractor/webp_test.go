@@ -2,15 +2,20 @@ package extractor_test
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"image/color"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/pillowskiy/imagesize/extractor"
 )
 
 func TestWEBP(t *testing.T) {
 	t.Parallel()
-	extractor := extractor.WEBP{}
+	webp := extractor.WEBP{}
 
 	var (
 		webpRIFFHeader     = []byte("RIFF")
@@ -33,9 +38,11 @@ func TestWEBP(t *testing.T) {
 			Buf: mergeBuffers(
 				validWEBP,
 				[]byte("VP8 "),
-				make([]byte, 10),   // See https://datatracker.ietf.org/doc/html/rfc6386#section-1
-				[]byte{0x01, 0x00}, // Width: 1 (u16 little endian)
-				[]byte{0x02, 0x00}, // Width: 2 (u16 little endian)
+				make([]byte, 4),          // Chunk size
+				[]byte{0x00, 0x00, 0x00}, // Frame tag of a key frame
+				[]byte{0x9D, 0x01, 0x2A}, // Start code, see https://datatracker.ietf.org/doc/html/rfc6386#section-9.1
+				[]byte{0x01, 0x00},       // Width: 1 (u16 little endian)
+				[]byte{0x02, 0x00},       // Width: 2 (u16 little endian)
 			),
 		},
 		{
@@ -55,7 +62,8 @@ func TestWEBP(t *testing.T) {
 				validWEBP,
 				[]byte("VP8L"),
 				// See https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification#3_riff_header
-				make([]byte, 5),
+				make([]byte, 4), // Chunk size
+				[]byte{0x2F},    // Signature
 				// 14 bits for width and 14 bits for height:
 				[]byte{0x00, 0x40, 0x00},       // 3-byte representation: (0x00 | (0x01 << 14)) as Width+1: 1, Height+1: 2
 				[]byte{0x00, 0x00, 0x00, 0x00}, // alpha_is_used and version_number (3 bit code that must be set to 0)
@@ -66,7 +74,7 @@ func TestWEBP(t *testing.T) {
 	for _, validWEBP := range validWEBPs {
 		t.Run(fmt.Sprintf("ExtractSizeFromValidImage/%s", validWEBP.Name), func(t *testing.T) {
 			reader := bytes.NewReader(validWEBP.Buf)
-			width, height, err := extractor.ExtractSize(reader)
+			width, height, err := webp.ExtractSize(reader)
 			if err != nil {
 				t.Fatalf("expected no error, got %v", err)
 			}
@@ -81,6 +89,282 @@ func TestWEBP(t *testing.T) {
 		})
 	}
 
+	t.Run("ExtractEXIFOrientation", func(t *testing.T) {
+		exif := exifBlock(binary.LittleEndian,
+			[]tiffTestEntry{tiffShort(binary.LittleEndian, 0x0112, uint16(extractor.OrientationTransverse))},
+		)
+		exifSize := make([]byte, 4)
+		binary.LittleEndian.PutUint32(exifSize, uint32(len(exif)))
+
+		vp8x := func(flags byte) []byte {
+			return mergeBuffers(
+				validWEBP,
+				[]byte("VP8X"),
+				[]byte{0x0A, 0x00, 0x00, 0x00}, // Chunk size: 10
+				[]byte{flags, 0x00, 0x00, 0x00},
+				[]byte{0x00, 0x00, 0x00}, // Width+1: 1
+				[]byte{0x01, 0x00, 0x00}, // Height+1: 2
+				[]byte("VP8L"),
+				[]byte{0x05, 0x00, 0x00, 0x00}, // Odd chunk size, padded to 6 bytes
+				make([]byte, 6),
+				[]byte("EXIF"),
+				exifSize,
+				exif,
+			)
+		}
+
+		info, err := webp.ExtractInfo(bytes.NewReader(vp8x(0x08)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Orientation != extractor.OrientationTransverse {
+			t.Errorf("expected orientation %d, got %d", extractor.OrientationTransverse, info.Orientation)
+		}
+
+		if info.DisplayWidth != 2 || info.DisplayHeight != 1 {
+			t.Errorf("expected display size 2x1, got %dx%d", info.DisplayWidth, info.DisplayHeight)
+		}
+
+		// The EXIF chunk is ignored unless the VP8X flags announce it
+		info, err = webp.ExtractInfo(bytes.NewReader(vp8x(0x00)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Orientation != extractor.OrientationUnknown || info.DisplayWidth != 1 || info.DisplayHeight != 2 {
+			t.Errorf("expected no orientation and display size 1x2, got %+v", info.OrientedSize)
+		}
+	})
+
+	t.Run("ExtractAnimation", func(t *testing.T) {
+		chunk := func(fourCC string, data ...[]byte) []byte {
+			payload := mergeBuffers(data...)
+			size := make([]byte, 4)
+			binary.LittleEndian.PutUint32(size, uint32(len(payload)))
+			if len(payload)%2 == 1 {
+				payload = append(payload, 0x00)
+			}
+			return mergeBuffers([]byte(fourCC), size, payload)
+		}
+
+		buf := mergeBuffers(
+			validWEBP,
+			chunk("VP8X",
+				[]byte{0x12, 0x00, 0x00, 0x00}, // Animation and alpha
+				[]byte{0x63, 0x00, 0x00},       // Canvas width+1: 100
+				[]byte{0x31, 0x00, 0x00},       // Canvas height+1: 50
+			),
+			chunk("ANIM", []byte{0x10, 0x20, 0x30, 0xFF}, []byte{0x03, 0x00}),
+			chunk("ANMF",
+				[]byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, // Offset 0, 0
+				[]byte{0x63, 0x00, 0x00, 0x31, 0x00, 0x00}, // Size 100x50
+				[]byte{0x64, 0x00, 0x00, 0x00},             // 100ms, blend, keep
+				chunk("VP8L", make([]byte, 5)),
+			),
+			chunk("ANMF",
+				[]byte{0x05, 0x00, 0x00, 0x0A, 0x00, 0x00}, // Offset 10, 20
+				[]byte{0x09, 0x00, 0x00, 0x04, 0x00, 0x00}, // Size 10x5
+				[]byte{0xC8, 0x00, 0x00, 0x03},             // 200ms, no blend, dispose
+				chunk("ALPH", []byte{0x00}),
+				chunk("VP8 ", make([]byte, 10)),
+			),
+		)
+
+		info, err := extractor.WEBP{ReadFrames: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Width != 100 || info.Height != 50 {
+			t.Errorf("expected canvas size 100x50, got %dx%d", info.Width, info.Height)
+		}
+
+		if !info.Features.Animation || !info.Features.Alpha || info.Features.EXIF || !info.Alpha {
+			t.Errorf("expected animation and alpha features with an ALPH chunk, got %+v (ALPH: %v)", info.Features, info.Alpha)
+		}
+
+		if info.Animation == nil {
+			t.Fatal("expected animation, got nil")
+		}
+
+		animation := *info.Animation
+		if animation.Frames != 2 || animation.LoopCount != 3 || animation.Duration != 300*time.Millisecond {
+			t.Errorf("expected 2 frames played 3 times for 300ms, got %+v", animation.Animation)
+		}
+
+		if animation.BackgroundColor != (color.NRGBA{R: 0x30, G: 0x20, B: 0x10, A: 0xFF}) {
+			t.Errorf("expected background color #302010, got %+v", animation.BackgroundColor)
+		}
+
+		expected := extractor.WEBPFrame{X: 10, Y: 20, Width: 10, Height: 5, Duration: 200 * time.Millisecond, Dispose: true}
+		if len(animation.FrameInfo) != 2 || animation.FrameInfo[1] != expected {
+			t.Errorf("expected second frame %+v, got %+v", expected, animation.FrameInfo)
+		}
+
+		// Frames are only walked on request, the walk stops at the first frame
+		reader := &countingReader{ReadSeeker: bytes.NewReader(buf)}
+		info, err = webp.ExtractInfo(reader)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Animation == nil || info.Animation.LoopCount != 3 || info.Animation.Frames != 0 || info.Animation.FrameInfo != nil {
+			t.Errorf("expected the loop count without frames, got %+v", info.Animation)
+		}
+
+		if firstFrame := bytes.Index(buf, []byte("ANMF")) + 8; reader.read > firstFrame {
+			t.Errorf("expected the walk to stop at the first frame, got %d bytes read", reader.read)
+		}
+	})
+
+	t.Run("ReadColorProfile", func(t *testing.T) {
+		icc := iccProfile("mluc", "Display P3")
+		iccSize := make([]byte, 4)
+		binary.LittleEndian.PutUint32(iccSize, uint32(len(icc)))
+
+		buf := mergeBuffers(
+			validWEBP,
+			[]byte("VP8X"),
+			[]byte{0x0A, 0x00, 0x00, 0x00}, // Chunk size: 10
+			[]byte{0x20, 0x00, 0x00, 0x00}, // ICC profile
+			[]byte{0x00, 0x00, 0x00},       // Width+1: 1
+			[]byte{0x01, 0x00, 0x00},       // Height+1: 2
+			[]byte("ICCP"), iccSize, icc,
+			[]byte("VP8L"),
+			[]byte{0x05, 0x00, 0x00, 0x00},
+			make([]byte, 6),
+		)
+
+		info, err := extractor.WEBP{ReadColorProfile: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.ColorProfile == nil || !bytes.Equal(info.ColorProfile.ICC, icc) || info.ColorProfile.Description != "Display P3" {
+			t.Errorf("expected the Display P3 profile, got %+v", info.ColorProfile)
+		}
+
+		info, err = webp.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !info.Features.ICC || info.ColorProfile != nil {
+			t.Errorf("expected the ICC feature without color profile unless requested, got %+v", info)
+		}
+	})
+
+	t.Run("ReadXMP", func(t *testing.T) {
+		packet := xmpPacket(`xmp:Rating="1"`, "")
+		packetSize := make([]byte, 4)
+		binary.LittleEndian.PutUint32(packetSize, uint32(len(packet)))
+
+		padding := make([]byte, len(packet)&1)
+		buf := mergeBuffers(
+			validWEBP,
+			[]byte("VP8X"),
+			[]byte{0x0A, 0x00, 0x00, 0x00}, // Chunk size: 10
+			[]byte{0x04, 0x00, 0x00, 0x00}, // XMP metadata
+			[]byte{0x00, 0x00, 0x00},       // Width+1: 1
+			[]byte{0x01, 0x00, 0x00},       // Height+1: 2
+			[]byte("VP8L"),
+			[]byte{0x05, 0x00, 0x00, 0x00},
+			make([]byte, 6),
+			[]byte("XMP "), packetSize, packet, padding,
+		)
+
+		info, err := extractor.WEBP{ReadXMP: true}.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP == nil || !bytes.Equal(info.XMP.Packet, packet) || info.XMP.Properties["xmp:Rating"] != "1" {
+			t.Errorf("expected the packet of the XMP chunk, got %+v", info.XMP)
+		}
+
+		info, err = webp.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if !info.Features.XMP || info.XMP != nil {
+			t.Errorf("expected the XMP feature without XMP unless requested, got %+v", info)
+		}
+	})
+
+	t.Run("ExtractFeatures", func(t *testing.T) {
+		buf, err := os.ReadFile("../_testdata/webp/vp8x_180x180.webp")
+		if err != nil {
+			t.Fatalf("failed to read test file: %v", err)
+		}
+
+		info, err := webp.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		expected := extractor.WEBPFeatures{Alpha: true, EXIF: true}
+		if info.Features != expected || info.Animation != nil || info.Alpha {
+			t.Errorf("expected features %+v of a lossless still image, got %+v", expected, info)
+		}
+	})
+
+	t.Run("ExtractVP8ScaleFactors", func(t *testing.T) {
+		buf := mergeBuffers(
+			validWEBP,
+			[]byte("VP8 "),
+			make([]byte, 4),
+			[]byte{0x00, 0x00, 0x00},
+			[]byte{0x9D, 0x01, 0x2A},
+			[]byte{0x14, 0x40}, // Width: 20, scale 1 (5/4)
+			[]byte{0x0A, 0xC0}, // Height: 10, scale 3 (2)
+		)
+
+		info, err := webp.ExtractInfo(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.Width != 20 || info.Height != 10 {
+			t.Errorf("expected size 20x10 without scale bits, got %dx%d", info.Width, info.Height)
+		}
+
+		if info.HorizontalScale != 1 || info.VerticalScale != 3 {
+			t.Errorf("expected scale factors 1 and 3, got %d and %d", info.HorizontalScale, info.VerticalScale)
+		}
+	})
+
+	t.Run("InvalidBitstreamHeader", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			chunk  string
+			header []byte
+			field  string
+		}{
+			{name: "VP8InterFrame", chunk: "VP8 ", header: []byte{0x01, 0x00, 0x00, 0x9D, 0x01, 0x2A}, field: "key frame flag"},
+			{name: "VP8StartCode", chunk: "VP8 ", header: []byte{0x00, 0x00, 0x00, 0x9D, 0x01, 0x2B}, field: "start code"},
+			{name: "VP8LSignature", chunk: "VP8L", header: []byte{0x2E}, field: "signature"},
+			{name: "VP8LVersion", chunk: "VP8L", header: []byte{0x2F, 0x00, 0x00, 0x00, 0x20}, field: "version"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				buf := mergeBuffers(validWEBP, []byte(tt.chunk), make([]byte, 4), tt.header, make([]byte, 10))
+
+				_, _, err := webp.ExtractSize(bytes.NewReader(buf))
+				var bitstreamErr *extractor.WEBPBitstreamError
+				if !errors.As(err, &bitstreamErr) {
+					t.Fatalf("expected bitstream error, got %v", err)
+				}
+
+				if bitstreamErr.Chunk != tt.chunk || bitstreamErr.Field != tt.field {
+					t.Errorf("expected invalid %s of %q, got %+v", tt.field, tt.chunk, bitstreamErr)
+				}
+			})
+		}
+	})
+
 	t.Run("InvalidWEBPCompression", func(t *testing.T) {
 		invalidWEBP := mergeBuffers(
 			webpRIFFHeader,
@@ -90,7 +374,7 @@ func TestWEBP(t *testing.T) {
 		)
 
 		reader := bytes.NewReader(invalidWEBP)
-		_, _, err := extractor.ExtractSize(reader)
+		_, _, err := webp.ExtractSize(reader)
 
 		if err == nil {
 			t.Fatalf("expected error due to invalid VP8 format, got nil")
@@ -98,7 +382,7 @@ func TestWEBP(t *testing.T) {
 	})
 
 	t.Run("InvalidImageFormatDetection", func(t *testing.T) {
-		_, matched := extractor.MatchFormat([]byte("NOTWEBPHEADER"))
+		_, matched := webp.MatchFormat([]byte("NOTWEBPHEADER"))
 		if matched {
 			t.Error("expected no match for non-WebP file")
 		}
@@ -0,0 +1,139 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// Upper bound of the size of XMP packets, including the Extended XMP of JPEG files.
+const maxXMPSize = 4 << 20
+
+var (
+	rdfRDF         = xml.Name{Space: "rdf", Local: "RDF"}
+	rdfDescription = xml.Name{Space: "rdf", Local: "Description"}
+	rdfLi          = xml.Name{Space: "rdf", Local: "li"}
+)
+
+// XMP is an XMP packet embedded in an image.
+type XMP struct {
+	// Packet as stored in the file, usually starting with "<?xpacket" or "<x:xmpmeta".
+	Packet []byte
+
+	// Extended XMP of JPEG files whose packet is too large for a single segment, reassembled
+	// from the APP1 segments with the GUID announced by the packet. Nil for other files.
+	Extended []byte
+
+	// Simple properties of the packets by qualified name, using the prefixes of the packets,
+	// e.g. "xmp:Rating" or "dc:rights". Language alternatives hold their default value
+	// and other arrays their items separated by commas, structures are left out.
+	Properties map[string]string
+}
+
+// Creates an XMP from a packet, reading its properties on a best effort basis.
+func newXMP(packet []byte) *XMP {
+	packet = bytes.TrimRight(packet, "\x00")
+	xmp := &XMP{Packet: packet, Properties: make(map[string]string)}
+	readXMPProperties(packet, xmp.Properties)
+	return xmp
+}
+
+// Reads the properties of the top-level rdf:Description elements, either as attributes or as elements.
+// Malformed packets are read up to the first error.
+func readXMPProperties(packet []byte, properties map[string]string) {
+	decoder := xml.NewDecoder(bytes.NewReader(packet))
+
+	var (
+		stack []xml.Name
+
+		// Property element being read, its depth and the text and array items read so far
+		property      string
+		propertyDepth int
+		text          strings.Builder
+		items         []string
+		alternative   bool
+		structure     bool
+		defaultItem   string
+		isDefault     bool
+	)
+
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			return
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth := len(stack)
+			switch {
+			case t.Name == rdfDescription && depth > 0 && stack[depth-1] == rdfRDF:
+				for _, attr := range t.Attr {
+					if isXMPProperty(attr.Name) {
+						properties[attr.Name.Space+":"+attr.Name.Local] = attr.Value
+					}
+				}
+			case property == "" && depth > 1 && stack[depth-1] == rdfDescription && stack[depth-2] == rdfRDF:
+				property, propertyDepth = t.Name.Space+":"+t.Name.Local, depth
+				text.Reset()
+				items, alternative, structure, defaultItem = nil, false, false, ""
+			case property != "" && t.Name.Space == "rdf" && t.Name.Local == "Alt":
+				alternative = true
+			case property != "" && t.Name.Space == "rdf" && (t.Name.Local == "Seq" || t.Name.Local == "Bag"):
+				// Ordered and unordered arrays, their items are joined
+			case property != "" && t.Name == rdfLi:
+				text.Reset()
+				isDefault = false
+				for _, attr := range t.Attr {
+					if attr.Name.Space == "xml" && attr.Name.Local == "lang" && attr.Value == "x-default" {
+						isDefault = true
+					}
+				}
+			case property != "":
+				structure = true
+			}
+			stack = append(stack, t.Name)
+		case xml.CharData:
+			if property != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return
+			}
+			stack = stack[:len(stack)-1]
+
+			switch {
+			case property == "":
+			case t.Name == rdfLi:
+				item := strings.TrimSpace(text.String())
+				items = append(items, item)
+				if isDefault {
+					defaultItem = item
+				}
+			case len(stack) == propertyDepth && structure:
+				property = ""
+			case len(stack) == propertyDepth:
+				value := strings.TrimSpace(text.String())
+				if items != nil {
+					switch {
+					case alternative && defaultItem != "":
+						value = defaultItem
+					case alternative:
+						value = items[0]
+					default:
+						value = strings.Join(items, ", ")
+					}
+				}
+
+				properties[property] = value
+				property = ""
+			}
+		}
+	}
+}
+
+// Attributes of rdf:Description elements are properties, except namespace declarations and RDF attributes.
+func isXMPProperty(name xml.Name) bool {
+	return name.Space != "" && name.Space != "xmlns" && name.Space != "rdf" && name.Space != "xml"
+}
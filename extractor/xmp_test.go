@@ -0,0 +1,106 @@
+package extractor_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pillowskiy/imagesize/extractor"
+)
+
+// Builds an XMP packet whose rdf:Description element has the given attributes and property elements.
+func xmpPacket(attributes, properties string) []byte {
+	return []byte("<?xpacket begin=\"\xef\xbb\xbf\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>" +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/" ` +
+		attributes + `>` + properties + `</rdf:Description></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`)
+}
+
+// Builds an infe box of a mime item holding XMP.
+func heifXMPItemEntry(id uint16) []byte {
+	return isoBox("infe", fullBox(2, 0), be16(id), be16(0), []byte("mime"), []byte{0x00}, []byte("application/rdf+xml\x00"))
+}
+
+func TestXMP(t *testing.T) {
+	t.Parallel()
+	heif := extractor.HEIF{ReadXMP: true}
+
+	// Primary image (1) described by the XMP item (3) stored in idat, after another XMP item (2) of the same data
+	file := func(packet []byte) []byte {
+		return heifFile("heic",
+			isoBox("pitm", fullBox(0, 0), be16(1)),
+			isoBox("iinf", fullBox(0, 0), be16(3), heifItemEntry(1, "hvc1"), heifXMPItemEntry(2), heifXMPItemEntry(3)),
+			isoBox("iref", fullBox(0, 0), heifReference("cdsc", 3, 1)),
+			isoBox("iprp",
+				isoBox("ipco", heifIspe(16, 8)),
+				isoBox("ipma", fullBox(0, 0), be32(1), heifAssociation(1, 0x01)),
+			),
+			isoBox("iloc", fullBox(1, 0), []byte{0x44, 0x00}, be16(2),
+				be16(2), be16(1), be16(0), be16(1), be32(0), be32(1),
+				be16(3), be16(1), be16(0), be16(1), be32(0), be32(uint32(len(packet))),
+			),
+			isoBox("idat", packet),
+		)
+	}
+
+	t.Run("ExtractProperties", func(t *testing.T) {
+		packet := xmpPacket(`xmp:Rating="4" xmp:CreatorTool="Test"`,
+			`<dc:rights><rdf:Alt><rdf:li xml:lang="fr-FR">Droits</rdf:li><rdf:li xml:lang="x-default">Rights</rdf:li></rdf:Alt></dc:rights>`+
+				`<dc:subject><rdf:Bag><rdf:li>sky</rdf:li><rdf:li>sea</rdf:li></rdf:Bag></dc:subject>`+
+				`<dc:format> image/heic </dc:format>`+
+				`<xmp:Thumbnails><rdf:Description><xmp:Format>JPEG</xmp:Format></rdf:Description></xmp:Thumbnails>`)
+
+		info, err := heif.ExtractInfo(bytes.NewReader(file(packet)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP == nil || !bytes.Equal(info.XMP.Packet, packet) {
+			t.Fatalf("expected the packet of the item describing the primary image, got %+v", info.XMP)
+		}
+
+		expected := map[string]string{
+			"xmp:Rating":      "4",
+			"xmp:CreatorTool": "Test",
+			"dc:rights":       "Rights",
+			"dc:subject":      "sky, sea",
+			"dc:format":       "image/heic",
+		}
+		if len(info.XMP.Properties) != len(expected) {
+			t.Errorf("expected properties %v, got %v", expected, info.XMP.Properties)
+		}
+		for name, value := range expected {
+			if info.XMP.Properties[name] != value {
+				t.Errorf("expected %s to be %q, got %q", name, value, info.XMP.Properties[name])
+			}
+		}
+	})
+
+	t.Run("MalformedPacket", func(t *testing.T) {
+		packet := xmpPacket(`xmp:Rating="2"`, `<dc:format>image/heic</dc:format><dc:title>&unknown;</dc:title>`)
+
+		info, err := heif.ExtractInfo(bytes.NewReader(file(packet)))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		// Properties are read up to the error
+		if info.XMP == nil || info.XMP.Properties["xmp:Rating"] != "2" || info.XMP.Properties["dc:format"] != "image/heic" {
+			t.Fatalf("expected the packet with the properties preceding the error, got %+v", info.XMP)
+		}
+
+		if title, ok := info.XMP.Properties["dc:title"]; ok {
+			t.Errorf("expected no title past the error, got %q", title)
+		}
+	})
+
+	t.Run("NotRequested", func(t *testing.T) {
+		info, err := extractor.HEIF{}.ExtractInfo(bytes.NewReader(file(xmpPacket("", ""))))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if info.XMP != nil {
+			t.Errorf("expected no XMP unless requested, got %+v", info.XMP)
+		}
+	})
+}
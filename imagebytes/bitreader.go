@@ -0,0 +1,104 @@
+package imagebytes
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrExpGolombOverflow = errors.New("exp-golomb code is too long")
+
+// BitReader reads bit fields from a byte slice, most significant bit first,
+// as used by video bitstreams such as HEVC and AV1.
+type BitReader struct {
+	buf []byte
+	pos int // Position in bits
+}
+
+// Creates a BitReader positioned at the first bit of buf.
+func NewBitReader(buf []byte) *BitReader {
+	return &BitReader{buf: buf}
+}
+
+// Reads n bits (up to 64) as an unsigned integer.
+func (r *BitReader) ReadBits(n int) (uint64, error) {
+	if n < 0 || n > 64 {
+		return 0, errors.New("invalid bit count")
+	}
+
+	if r.pos+n > len(r.buf)*8 {
+		r.pos = len(r.buf) * 8
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	var result uint64
+	for i := 0; i < n; i++ {
+		bit := r.buf[r.pos>>3] >> (7 - uint(r.pos&7)) & 1
+		result = result<<1 | uint64(bit)
+		r.pos++
+	}
+
+	return result, nil
+}
+
+// Reads a single bit as a boolean flag.
+func (r *BitReader) ReadFlag() (bool, error) {
+	bit, err := r.ReadBits(1)
+	return bit == 1, err
+}
+
+// Skips n bits.
+func (r *BitReader) Skip(n int) error {
+	if n < 0 || r.pos+n > len(r.buf)*8 {
+		r.pos = len(r.buf) * 8
+		return io.ErrUnexpectedEOF
+	}
+
+	r.pos += n
+	return nil
+}
+
+// Reads an unsigned Exp-Golomb code, ue(v) in H.264/HEVC syntax:
+// N leading zero bits, a one bit, then N bits added to 2^N - 1.
+func (r *BitReader) ReadUE() (uint64, error) {
+	leadingZeros := 0
+	for {
+		bit, err := r.ReadBits(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+
+		leadingZeros++
+		if leadingZeros > 32 {
+			return 0, ErrExpGolombOverflow
+		}
+	}
+
+	value, err := r.ReadBits(leadingZeros)
+	if err != nil {
+		return 0, err
+	}
+
+	return (1<<uint(leadingZeros) - 1) + value, nil
+}
+
+// Reads a signed Exp-Golomb code, se(v) in H.264/HEVC syntax,
+// mapping 1, 2, 3, 4... to 1, -1, 2, -2...
+func (r *BitReader) ReadSE() (int64, error) {
+	value, err := r.ReadUE()
+	if err != nil {
+		return 0, err
+	}
+
+	if value&1 == 1 {
+		return int64(value+1) / 2, nil
+	}
+	return -int64(value / 2), nil
+}
+
+// Returns the number of bits left to read.
+func (r *BitReader) BitsLeft() int {
+	return len(r.buf)*8 - r.pos
+}
@@ -0,0 +1,112 @@
+package imagebytes_test
+
+import (
+	"testing"
+
+	"github.com/pillowskiy/imagesize/imagebytes"
+)
+
+func TestBitReader_ReadBits(t *testing.T) {
+	t.Parallel()
+
+	reader := imagebytes.NewBitReader([]byte{0b10110010, 0b01111111})
+
+	tests := []struct {
+		name     string
+		bits     int
+		expected uint64
+	}{
+		{name: "SingleBit", bits: 1, expected: 0b1},
+		{name: "ThreeBits", bits: 3, expected: 0b011},
+		{name: "AcrossBytes", bits: 8, expected: 0b00100111},
+		{name: "Remaining", bits: 4, expected: 0b1111},
+	}
+
+	for _, tt := range tests {
+		result, err := reader.ReadBits(tt.bits)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.name, err)
+		}
+		if result != tt.expected {
+			t.Errorf("%s: expected %b, got %b", tt.name, tt.expected, result)
+		}
+	}
+
+	if reader.BitsLeft() != 0 {
+		t.Errorf("expected no bits left, got %d", reader.BitsLeft())
+	}
+
+	if _, err := reader.ReadBits(1); err == nil {
+		t.Error("expected error when reading past the end, got nil")
+	}
+}
+
+func TestBitReader_ReadUE(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		buf       []byte
+		expected  uint64
+		expectErr bool
+	}{
+		{name: "Zero", buf: []byte{0b10000000}, expected: 0},
+		{name: "One", buf: []byte{0b01000000}, expected: 1},
+		{name: "Two", buf: []byte{0b01100000}, expected: 2},
+		{name: "Seven", buf: []byte{0b00010000, 0b00000000}, expected: 7},
+		{name: "Large", buf: []byte{0b00000000, 0b10000000, 0b10000000}, expected: 256},
+		{name: "Truncated", buf: []byte{0b00000001}, expectErr: true},
+		{name: "Overflow", buf: make([]byte, 8), expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := imagebytes.NewBitReader(tt.buf).ReadUE()
+			if (err != nil) != tt.expectErr {
+				t.Fatalf("expected error: %v, got: %v", tt.expectErr, err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestBitReader_ReadSE(t *testing.T) {
+	t.Parallel()
+
+	// ue values 0, 1, 2, 3, 4 packed one after another: 1 010 011 00100 00101
+	reader := imagebytes.NewBitReader([]byte{0b10100110, 0b01000010, 0b10000000})
+	expected := []int64{0, 1, -1, 2, -2}
+
+	for _, exp := range expected {
+		result, err := reader.ReadSE()
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result != exp {
+			t.Errorf("expected %d, got %d", exp, result)
+		}
+	}
+}
+
+func TestBitReader_Skip(t *testing.T) {
+	t.Parallel()
+
+	reader := imagebytes.NewBitReader([]byte{0b00001111})
+	if err := reader.Skip(4); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	result, err := reader.ReadBits(4)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result != 0b1111 {
+		t.Errorf("expected %b, got %b", 0b1111, result)
+	}
+
+	if err := reader.Skip(1); err == nil {
+		t.Error("expected error when skipping past the end, got nil")
+	}
+}
@@ -93,6 +93,27 @@ func ReadU32(reader io.Reader, endianness Endian) (uint32, error) {
 	return result, nil
 }
 
+// Reads a 64-bit unsigned integer from the provided reader, interpreting the data
+// according to the specified byte order (endianness).
+func ReadU64(reader io.Reader, endianness Endian) (uint64, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return 0, err
+	}
+
+	var result uint64
+	switch endianness {
+	case LittleEndian:
+		result = binary.LittleEndian.Uint64(buf)
+	case BigEndian:
+		result = binary.BigEndian.Uint64(buf)
+	default:
+		return 0, ErrUnsupportedEndian
+	}
+
+	return result, nil
+}
+
 // ReadTag reads a 4 byte tag and its associated size (uint32) from the provided reader.
 // It returns the tag as a string and the size as an integer, along with any errors encountered during reading.
 //
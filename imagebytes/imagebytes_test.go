@@ -185,6 +185,60 @@ func TestReadU32(t *testing.T) {
 	}
 }
 
+func TestReadU64(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		buf        []byte
+		endianness imagebytes.Endian
+		expected   uint64
+		expectErr  bool
+	}{
+		{
+			name:       "LittleEndian_U64",
+			buf:        []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			endianness: imagebytes.LittleEndian,
+			expected:   0x0807060504030201,
+			expectErr:  false,
+		},
+		{
+			name:       "BigEndian_U64",
+			buf:        []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			endianness: imagebytes.BigEndian,
+			expected:   0x0102030405060708,
+			expectErr:  false,
+		},
+		{
+			name:       "Invalid_Endian",
+			buf:        []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08},
+			endianness: 99,
+			expected:   0,
+			expectErr:  true,
+		},
+		{
+			name:       "Too_Short",
+			buf:        []byte{0x01, 0x02, 0x03, 0x04},
+			endianness: imagebytes.BigEndian,
+			expected:   0,
+			expectErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bytes.NewReader(tt.buf)
+			result, err := imagebytes.ReadU64(reader, tt.endianness)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("expected error: %v, got: %v", tt.expectErr, err)
+			}
+			if result != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
 func TestReadTag(t *testing.T) {
 	t.Parallel()
 
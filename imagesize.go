@@ -74,7 +74,12 @@ func extractInfo(reader io.ReadSeeker) (info *ImageInfo, err error) {
 
 		info.Format = format
 
-		width, height, err := ext.ExtractSize(reader)
+		var width, height int
+		if detailsExt, ok := ext.(DetailsExtractor); ok {
+			width, height, info.Details, err = detailsExt.ExtractDetails(reader)
+		} else {
+			width, height, err = ext.ExtractSize(reader)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -82,6 +87,34 @@ func extractInfo(reader io.ReadSeeker) (info *ImageInfo, err error) {
 		info.Width = width
 		info.Height = height
 
+		info.Display = info.ImageSize
+		if orientedDetails, ok := info.Details.(OrientedDetails); ok {
+			oriented := orientedDetails.Oriented()
+			info.Orientation = oriented.Orientation
+			info.Display = ImageSize{Width: oriented.DisplayWidth, Height: oriented.DisplayHeight}
+		}
+
+		if resolutionDetails, ok := info.Details.(ResolutionDetails); ok {
+			info.Resolution = resolutionDetails.PhysicalResolution()
+		}
+
+		if gainMapDetails, ok := info.Details.(GainMapDetails); ok {
+			info.GainMap = gainMapDetails.HDRGainMap()
+		}
+
+		info.Codec = format
+		if codecDetails, ok := info.Details.(CodecDetails); ok {
+			if codec := codecDetails.Codec(); codec != "" {
+				info.Codec = codec
+			}
+		}
+
+		if formatDetails, ok := info.Details.(FormatDetails); ok {
+			if variant := formatDetails.Format(); variant != "" {
+				info.Format = variant
+			}
+		}
+
 		return info, err
 	}
 
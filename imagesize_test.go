@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/pillowskiy/imagesize"
+	"github.com/pillowskiy/imagesize/extractor"
 )
 
 type TestCase struct {
@@ -34,6 +35,7 @@ var testCases = []TestGroup{
 						Height: 20,
 					},
 					Format: "avif",
+					Codec:  "av01",
 				},
 			},
 		},
@@ -49,6 +51,7 @@ var testCases = []TestGroup{
 						Height: 200,
 					},
 					Format: "gif",
+					Codec:  "gif",
 				},
 			},
 		},
@@ -64,6 +67,7 @@ var testCases = []TestGroup{
 						Height: 3264,
 					},
 					Format: "heic",
+					Codec:  "hvc1",
 				},
 			},
 
@@ -76,6 +80,7 @@ var testCases = []TestGroup{
 						Height: 720,
 					},
 					Format: "heic",
+					Codec:  "hvc1",
 				},
 			},
 		},
@@ -91,6 +96,19 @@ var testCases = []TestGroup{
 						Height: 20,
 					},
 					Format: "jpeg",
+					Codec:  "jpeg",
+				},
+			},
+			{
+				Name: "MPO",
+				Path: "_testdata/jpeg/64x32.mpo",
+				Expected: &imagesize.ImageInfo{
+					ImageSize: imagesize.ImageSize{
+						Width:  64,
+						Height: 32,
+					},
+					Format: "mpo",
+					Codec:  "jpeg",
 				},
 			},
 		},
@@ -106,6 +124,7 @@ var testCases = []TestGroup{
 						Height: 20,
 					},
 					Format: "png",
+					Codec:  "png",
 				},
 			},
 			{
@@ -117,6 +136,7 @@ var testCases = []TestGroup{
 						Height: 100,
 					},
 					Format: "png",
+					Codec:  "png",
 				},
 			},
 		},
@@ -133,6 +153,7 @@ var testCases = []TestGroup{
 						Height: 20,
 					},
 					Format: "webp",
+					Codec:  "webp",
 				},
 			},
 			{
@@ -144,6 +165,7 @@ var testCases = []TestGroup{
 						Height: 20,
 					},
 					Format: "webp",
+					Codec:  "webp",
 				},
 			},
 			{
@@ -155,6 +177,7 @@ var testCases = []TestGroup{
 						Height: 180,
 					},
 					Format: "webp",
+					Codec:  "webp",
 				},
 			},
 		},
@@ -169,6 +192,7 @@ func assertEqual(t *testing.T, expected, actual interface{}, msg string) {
 
 func assertEqualInfo(t *testing.T, expected, actual *imagesize.ImageInfo) {
 	assertEqual(t, expected.Format, actual.Format, "Format mismatch")
+	assertEqual(t, expected.Codec, actual.Codec, "Codec mismatch")
 	assertEqual(t, expected.Width, actual.Width, "Width mismatch")
 	assertEqual(t, expected.Height, actual.Height, "Height mismatch")
 }
@@ -243,3 +267,55 @@ func TestExtractInfo_ReaderPosition_Unchanged(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractFileInfo_Details(t *testing.T) {
+	t.Parallel()
+
+	info, err := imagesize.ExtractFileInfo("_testdata/heic/heic.heic")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	details, ok := info.Details.(*extractor.HEIFInfo)
+	if !ok {
+		t.Fatalf("expected *extractor.HEIFInfo details, got %T", info.Details)
+	}
+
+	assertEqual(t, info.Width, details.Width, "Details width mismatch")
+	assertEqual(t, info.Height, details.Height, "Details height mismatch")
+}
+
+func TestExtractFileInfo_Orientation(t *testing.T) {
+	t.Parallel()
+
+	// The Exif item is rotated by 90 degrees, which the irot property of the primary item already applies
+	info, err := imagesize.ExtractFileInfo("_testdata/heic/heic.heic")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertEqual(t, extractor.OrientationRotate90, info.Orientation, "Orientation mismatch")
+	assertEqual(t, info.ImageSize, info.Display, "Display size mismatch")
+
+	// Images without orientation are displayed as stored
+	info, err = imagesize.ExtractFileInfo("_testdata/png/20x20.png")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertEqual(t, extractor.OrientationUnknown, info.Orientation, "Orientation mismatch")
+	assertEqual(t, info.ImageSize, info.Display, "Display size mismatch")
+}
+
+func TestExtractFileInfo_Resolution(t *testing.T) {
+	t.Parallel()
+
+	info, err := imagesize.ExtractFileInfo("_testdata/heic/heic.heic")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertEqual(t, extractor.ResolutionEXIF, info.Resolution.ResolutionSource, "Resolution source mismatch")
+	assertEqual(t, 72.0, info.Resolution.XDPI, "DPI mismatch")
+	assertEqual(t, 2448.0/72, info.Resolution.WidthInches, "Physical width mismatch")
+}
@@ -1,6 +1,10 @@
 package imagesize
 
-import "io"
+import (
+	"io"
+
+	"github.com/pillowskiy/imagesize/extractor"
+)
 
 // Interface for extracting size from various formats.
 type SizeExtractor interface {
@@ -26,6 +30,47 @@ type SizeExtractor interface {
 	ExtractSize(reader io.ReadSeeker) (width int, height int, err error)
 }
 
+// DetailsExtractor is an optional interface that a SizeExtractor can implement
+// to report format-specific details along with the dimensions in a single pass.
+type DetailsExtractor interface {
+	// ExtractDetails behaves like ExtractSize and additionally returns a format-specific
+	// value describing the image (e.g. *extractor.HEIFInfo), which is stored in ImageInfo.Details.
+	ExtractDetails(reader io.ReadSeeker) (width int, height int, details interface{}, err error)
+}
+
+// CodecDetails is implemented by details of container formats that can hold images coded
+// in different ways, to report the codec separately from the container format.
+type CodecDetails interface {
+	// Codec returns the coding of the image, e.g. "hvc1", "av01" or "jpeg".
+	Codec() string
+}
+
+// FormatDetails is implemented by details of formats with variants that can only be told apart
+// once the file is read, to refine the format detected from the header of the file.
+type FormatDetails interface {
+	// Format returns the variant of the format, e.g. "mpo" for multi-picture JPEG files,
+	// or an empty string to keep the detected format.
+	Format() string
+}
+
+// OrientedDetails is implemented by details of formats that can carry an EXIF orientation.
+type OrientedDetails interface {
+	// Oriented returns the orientation of the image and its size once displayed.
+	Oriented() extractor.OrientedSize
+}
+
+// ResolutionDetails is implemented by details of formats that can carry a physical resolution.
+type ResolutionDetails interface {
+	// PhysicalResolution returns the DPI of the image, its source and the physical size computed from it.
+	PhysicalResolution() extractor.Resolution
+}
+
+// GainMapDetails is implemented by details of formats that can carry an HDR gain map.
+type GainMapDetails interface {
+	// HDRGainMap returns the gain map of the image and its size, nil if the image has none.
+	HDRGainMap() *extractor.GainMap
+}
+
 type ImageSize struct {
 	Width  int
 	Height int
@@ -33,5 +78,28 @@ type ImageSize struct {
 
 type ImageInfo struct {
 	ImageSize
+
+	// Format of the file (container), e.g. "heic", "avif", "heif" or "png", see FormatDetails.
 	Format string
+
+	// Coding of the image within the container, e.g. "hvc1" or "av01" for HEIF based formats.
+	// It equals Format for formats that are not containers, see CodecDetails.
+	Codec string
+
+	// Orientation of the image from its EXIF data, see OrientedDetails.
+	Orientation extractor.Orientation
+
+	// Size of the image once displayed according to its orientation.
+	// It equals ImageSize for images without an orientation.
+	Display ImageSize
+
+	// Resolution of the image and its physical size, see ResolutionDetails.
+	// It is zero for images without a resolution.
+	Resolution extractor.Resolution
+
+	// Gain map of HDR images and its size, see GainMapDetails. It is nil for images without a gain map.
+	GainMap *extractor.GainMap
+
+	// Format-specific details reported by extractors implementing DetailsExtractor, nil otherwise.
+	Details interface{}
 }